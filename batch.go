@@ -0,0 +1,181 @@
+package direwolf
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchOptions is the options of Session.SendAll and Session.SendStream.
+type BatchOptions struct {
+	// Concurrency limits the number of requests in flight, include the
+	// results not consumed yet. Default is 10.
+	Concurrency int
+
+	// FailFast cancels the rest requests when any request failed. The
+	// canceled requests are reported with context.Canceled.
+	FailFast bool
+
+	// Ordered makes SendStream emit results in the same order as the
+	// requests. SendAll always returns results in order.
+	Ordered bool
+}
+
+// DefaultBatchOptions return a default BatchOptions object.
+func DefaultBatchOptions() *BatchOptions {
+	return &BatchOptions{
+		Concurrency: 10,
+		FailFast:    false,
+		Ordered:     false,
+	}
+}
+
+// BatchResult is the result of a request sent by SendAll or SendStream.
+type BatchResult struct {
+	// Index is the position of the request in the input slice.
+	Index    int
+	Request  *Request
+	Response *Response
+	Err      error
+}
+
+// BatchError is returned by SendAll when some of the requests failed.
+type BatchError struct {
+	// Failed is the failed results in order.
+	Failed []*BatchResult
+	Total  int
+}
+
+func (e *BatchError) Error() string {
+	first := e.Failed[0]
+	return fmt.Sprintf("%d of %d requests failed, first failed request %d: %s",
+		len(e.Failed), e.Total, first.Index, first.Err.Error())
+}
+
+// Unwrap returns the errors of failed requests, so errors.Is and errors.As
+// can check them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failed))
+	for _, result := range e.Failed {
+		errs = append(errs, result.Err)
+	}
+	return errs
+}
+
+// SendAll sends the requests concurrently and returns the results in the same
+// order as the requests. If any request failed, a *BatchError is returned
+// together with all the results.
+//
+// All the responses are kept in memory until SendAll returns. Use SendStream
+// to consume them one by one when sending a large number of requests.
+func (session *Session) SendAll(ctx context.Context, reqs []*Request, options ...*BatchOptions) ([]*BatchResult, error) {
+	opts := *batchOptions(options)
+	opts.Ordered = false // results are placed by index, no need to wait for order.
+
+	results := make([]*BatchResult, len(reqs))
+	var failed []*BatchResult
+	for result := range session.SendStream(ctx, reqs, &opts) {
+		results[result.Index] = result
+	}
+	for i, result := range results {
+		if result == nil { // ctx is done before the result emitted.
+			result = &BatchResult{Index: i, Request: reqs[i], Err: WrapErr(ctx.Err(), "request not sent")}
+			results[i] = result
+		}
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		return results, &BatchError{Failed: failed, Total: len(reqs)}
+	}
+	return results, nil
+}
+
+// SendStream sends the requests concurrently and emits the results by the
+// returned channel, as they complete or in order if BatchOptions.Ordered is
+// set. The channel is closed after all the results are emitted, or ctx is done.
+//
+// At most BatchOptions.Concurrency requests are in flight or waiting to be
+// consumed, so the memory stays bounded however many requests are sent.
+// Consumer should read the channel until it is closed, or cancel ctx.
+func (session *Session) SendStream(ctx context.Context, reqs []*Request, options ...*BatchOptions) <-chan *BatchResult {
+	opts := batchOptions(options)
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchOptions().Concurrency
+	}
+
+	sendCtx, cancelSend := context.WithCancel(ctx)
+	slots := make(chan struct{}, concurrency)    // limits requests in flight or not consumed.
+	done := make(chan *BatchResult, concurrency) // receives results from workers.
+	out := make(chan *BatchResult)
+
+	// dispatch requests to workers when there is a free slot.
+	go func() {
+		for i, req := range reqs {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, req *Request) {
+				result := &BatchResult{Index: i, Request: req}
+				if err := sendCtx.Err(); err != nil {
+					result.Err = WrapErr(err, "request not sent")
+				} else {
+					result.Response, result.Err = session.SendContext(sendCtx, req)
+				}
+				done <- result
+			}(i, req)
+		}
+	}()
+
+	// collect results and emit them, release the slot after it is consumed.
+	go func() {
+		defer close(out)
+		defer cancelSend()
+
+		pending := make(map[int]*BatchResult) // results waiting for order.
+		next := 0
+		for emitted := 0; emitted < len(reqs); {
+			var result *BatchResult
+			select {
+			case result = <-done:
+			case <-ctx.Done():
+				return
+			}
+			if result.Err != nil && opts.FailFast {
+				cancelSend()
+			}
+
+			ready := []*BatchResult{result}
+			if opts.Ordered {
+				pending[result.Index] = result
+				ready = ready[:0]
+				for pending[next] != nil {
+					ready = append(ready, pending[next])
+					delete(pending, next)
+					next++
+				}
+			}
+			for _, r := range ready {
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return
+				}
+				emitted++
+				<-slots
+			}
+		}
+	}()
+	return out
+}
+
+// batchOptions returns the first options or a default one.
+func batchOptions(options []*BatchOptions) *BatchOptions {
+	if len(options) > 0 && options[0] != nil {
+		return options[0]
+	}
+	return DefaultBatchOptions()
+}
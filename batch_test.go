@@ -0,0 +1,125 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBatchServer(inFlight, maxInFlight *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			max := atomic.LoadInt32(maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(maxInFlight, max, current) {
+				break
+			}
+		}
+
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		_, _ = w.Write([]byte(strconv.Itoa(n)))
+	}))
+}
+
+func newBatchRequests(t *testing.T, url string, delays ...int) []*Request {
+	var reqs []*Request
+	for _, delay := range delays {
+		req, err := NewRequest("GET", url, NewParams("n", strconv.Itoa(delay)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+func TestSendAll(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := newTestBatchServer(&inFlight, &maxInFlight)
+	defer ts.Close()
+
+	reqs := newBatchRequests(t, ts.URL, 50, 10, 30, 20, 40, 0, 10, 20)
+	session := NewSession()
+	results, err := session.SendAll(context.Background(), reqs, &BatchOptions{Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result.Index != i || result.Request != reqs[i] || result.Response.Text() != reqs[i].Params.Get("n") {
+			t.Fatal("SendAll results are not in order.")
+		}
+	}
+	if maxInFlight > 3 {
+		t.Fatal("SendAll exceeded concurrency limit: ", maxInFlight)
+	}
+}
+
+func TestSendAllError(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := newTestBatchServer(&inFlight, &maxInFlight)
+	defer ts.Close()
+
+	reqs := newBatchRequests(t, ts.URL, 0, 10, 20)
+	reqs = append(reqs, &Request{Method: "GET", URL: "://bad url"})
+	session := NewSession()
+	results, err := session.SendAll(context.Background(), reqs)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatal("SendAll should return BatchError: ", err)
+	}
+	if len(batchErr.Failed) != 1 || batchErr.Failed[0].Index != 3 || results[0].Response.Text() != "0" {
+		t.Fatal("SendAll per-request error failed.")
+	}
+
+	reqs = newBatchRequests(t, ts.URL, 0, 200, 200, 200, 200)
+	reqs = append([]*Request{{Method: "GET", URL: "://bad url"}}, reqs...)
+	_, err = session.SendAll(context.Background(), reqs, &BatchOptions{Concurrency: 2, FailFast: true})
+	if !errors.As(err, &batchErr) || !errors.Is(err, context.Canceled) {
+		t.Fatal("SendAll should cancel the rest requests when fail fast: ", err)
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := newTestBatchServer(&inFlight, &maxInFlight)
+	defer ts.Close()
+
+	session := NewSession()
+	reqs := newBatchRequests(t, ts.URL, 60, 0, 30, 10)
+	var order []int
+	for result := range session.SendStream(context.Background(), reqs, &BatchOptions{Concurrency: 4}) {
+		if result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		order = append(order, result.Index)
+	}
+	if len(order) != 4 || order[0] != 1 || order[3] != 0 {
+		t.Fatal("SendStream should emit results as they complete: ", order)
+	}
+
+	order = order[:0]
+	stream := session.SendStream(context.Background(), reqs, &BatchOptions{Concurrency: 2, Ordered: true})
+	for result := range stream {
+		order = append(order, result.Index)
+		time.Sleep(10 * time.Millisecond) // slow consumer
+	}
+	for i, index := range order {
+		if index != i {
+			t.Fatal("SendStream should emit results in order: ", order)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream = session.SendStream(ctx, newBatchRequests(t, ts.URL, 0, 0, 0, 0), &BatchOptions{Concurrency: 1})
+	<-stream
+	cancel()
+	for range stream {
+	}
+}
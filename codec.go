@@ -0,0 +1,192 @@
+package direwolf
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrCodec is returned when there is no codec for the media type.
+var ErrCodec = errors.New("no codec for media type")
+
+// Codec marshals and unmarshals the body of a media type. Register it by
+// RegisterCodec to be used by CodecBody and Response.Decode.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec("application/json", jsonCodec{})
+	RegisterCodec("application/xml", xmlCodec{})
+	RegisterCodec("text/xml", xmlCodec{})
+	RegisterCodec("application/yaml", yamlCodec{})
+	RegisterCodec("application/x-yaml", yamlCodec{})
+	RegisterCodec("text/yaml", yamlCodec{})
+	RegisterCodec("application/msgpack", msgpackCodec{})
+	RegisterCodec("application/x-msgpack", msgpackCodec{})
+	RegisterCodec("application/protobuf", protoCodec{})
+	RegisterCodec("application/x-protobuf", protoCodec{})
+}
+
+// RegisterCodec registers the codec of media type like "application/cbor",
+// it replaces the codec registered before. It is safe for concurrent use.
+func RegisterCodec(mediaType string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(mediaType)] = c
+}
+
+// lookupCodec returns the codec of contentType. The media type with
+// structured syntax suffix like "application/soap+xml" uses the codec of
+// "application/xml" if it is not registered.
+func lookupCodec(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, WrapErrf(ErrCodec, "invalid content type: %s", contentType)
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, ok := codecs[mediaType]; ok {
+		return c, nil
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		if c, ok := codecs["application/"+mediaType[i+1:]]; ok {
+			return c, nil
+		}
+	}
+	return nil, WrapErrf(ErrCodec, "%s", mediaType)
+}
+
+// CodecBody is the body encoded by the codec of ContentType, the
+// Content-Type header is set if it is not set in request.
+type CodecBody struct {
+	ContentType string
+	Value       interface{}
+}
+
+// NewCodecBody new a body encoded by the codec of contentType.
+func NewCodecBody(contentType string, v interface{}) *CodecBody {
+	return &CodecBody{ContentType: contentType, Value: v}
+}
+
+// XMLBody new a body encoded as application/xml.
+func XMLBody(v interface{}) *CodecBody {
+	return NewCodecBody("application/xml", v)
+}
+
+// YAMLBody new a body encoded as application/yaml.
+func YAMLBody(v interface{}) *CodecBody {
+	return NewCodecBody("application/yaml", v)
+}
+
+// MsgpackBody new a body encoded as application/msgpack.
+func MsgpackBody(v interface{}) *CodecBody {
+	return NewCodecBody("application/msgpack", v)
+}
+
+// ProtoBody new a body encoded as application/x-protobuf.
+func ProtoBody(msg proto.Message) *CodecBody {
+	return NewCodecBody("application/x-protobuf", msg)
+}
+
+// RequestOption interface method, the value is encoded when bound, and the
+// error is returned by NewRequest.
+func (options *CodecBody) bindRequest(request *Request) error {
+	c, err := lookupCodec(options.ContentType)
+	if err != nil {
+		return err
+	}
+	body, err := c.Marshal(options.Value)
+	if err != nil {
+		return WrapErrf(err, "encode %s body failed", options.ContentType)
+	}
+	request.Body = body
+	if request.Headers == nil {
+		request.Headers = http.Header{}
+	}
+	if request.Headers.Get("Content-Type") == "" {
+		request.Headers.Set("Content-Type", options.ContentType)
+	}
+	return nil
+}
+
+// Decode unmarshals the content into v by the codec of the Content-Type of
+// response, such as JSON, XML, YAML, MessagePack and Protobuf. It returns
+// ErrCodec if there is no codec for the Content-Type.
+func (resp *Response) Decode(v interface{}) error {
+	c, err := lookupCodec(resp.Headers.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	if err := c.Unmarshal(resp.Content, v); err != nil {
+		return WrapErr(err, "decode response failed")
+	}
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return jsoniter.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return jsoniter.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+type yamlCodec struct{}
+
+func (yamlCodec) Marshal(v interface{}) ([]byte, error)      { return yaml.Marshal(v) }
+func (yamlCodec) Unmarshal(data []byte, v interface{}) error { return yaml.Unmarshal(data, v) }
+
+// msgpackHandle decodes the strings to string instead of []byte.
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	return h
+}()
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(v)
+	return data, err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,100 @@
+package direwolf
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecUser struct {
+	ID   int    `json:"id" xml:"id" yaml:"id"`
+	Name string `json:"name" xml:"name" yaml:"name"`
+}
+
+// newEchoContentTypeHandler responds the body and Content-Type of request.
+func newEchoContentTypeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+}
+
+func TestCodecBody(t *testing.T) {
+	ts := httptest.NewServer(newEchoContentTypeHandler())
+	defer ts.Close()
+
+	user := codecUser{ID: 1, Name: "direwolf"}
+	bodies := []*CodecBody{XMLBody(&user), YAMLBody(&user), MsgpackBody(&user), NewCodecBody("application/vnd.user+json", &user)}
+	for _, body := range bodies {
+		resp, err := Post(ts.URL, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Headers.Get("Content-Type") != body.ContentType {
+			t.Fatal("CodecBody should set Content-Type: ", resp.Headers.Get("Content-Type"))
+		}
+		var output codecUser
+		if err := resp.Decode(&output); err != nil {
+			t.Fatal(err)
+		}
+		if output != user {
+			t.Fatal("Response.Decode failed: ", body.ContentType, output)
+		}
+	}
+
+	resp, err := Post(ts.URL, ProtoBody(&wrapperspb.StringValue{Value: "winter"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg wrapperspb.StringValue
+	if err := resp.Decode(&msg); err != nil || msg.Value != "winter" {
+		t.Fatal("decode protobuf failed: ", msg.Value, err)
+	}
+
+	resp, err = Post(ts.URL, Body("text"), NewHeaders("Content-Type", "text/plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resp.Decode(&msg); !errors.Is(err, ErrCodec) {
+		t.Fatal("Decode should fail without codec: ", err)
+	}
+	if _, err := NewRequest("POST", ts.URL, ProtoBody(nil)); err == nil {
+		t.Fatal("CodecBody should return encode error.")
+	}
+}
+
+// upperCodec is a custom codec which encodes string in upper case.
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(string))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*string) = strings.ToLower(string(data))
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	ts := httptest.NewServer(newEchoContentTypeHandler())
+	defer ts.Close()
+
+	RegisterCodec("application/x-upper", upperCodec{})
+	resp, err := Post(ts.URL, NewCodecBody("application/x-upper; charset=utf-8", "winter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output string
+	if err := resp.Decode(&output); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "WINTER" || output != "winter" {
+		t.Fatal("custom codec failed: ", resp.Text(), output)
+	}
+}
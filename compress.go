@@ -0,0 +1,165 @@
+package direwolf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrContentEncoding is returned when the content encoding is not supported.
+var ErrContentEncoding = errors.New("unsupported content encoding")
+
+// ErrDecompressedSize is returned when the decompressed content exceeds
+// SessionOptions.MaxDecompressedSize.
+var ErrDecompressedSize = errors.New("decompressed content is too large")
+
+// defaultMaxDecompressedSize is the default SessionOptions.MaxDecompressedSize.
+const defaultMaxDecompressedSize = 256 << 20
+
+// zstdEncoders and zstdDecoders pool the zstd encoders and decoders, which
+// allocate large buffers when they are made.
+var (
+	zstdEncoders sync.Pool
+	zstdDecoders sync.Pool
+)
+
+// acceptEncoding is the default Accept-Encoding header, direwolf can decode
+// all of them.
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// CompressBody is the content encoding to compress the request body, such as
+// "gzip", "deflate", "br" and "zstd". Content-Encoding header is set to it.
+type CompressBody string
+
+// RequestOption interface method, bind request option to request.
+func (options CompressBody) bindRequest(request *Request) error {
+	encoding := strings.ToLower(string(options))
+	if _, err := encodeContent(encoding, nil); err != nil {
+		return err
+	}
+	request.CompressBody = encoding
+	return nil
+}
+
+// encodeContent compress the content with the encoding.
+func encodeContent(encoding string, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		encoder, ok := zstdEncoders.Get().(*zstd.Encoder)
+		if !ok {
+			var err error
+			if encoder, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1)); err != nil {
+				return nil, WrapErr(err, "new zstd encoder failed")
+			}
+		}
+		defer zstdEncoders.Put(encoder)
+		return encoder.EncodeAll(content, nil), nil
+	default:
+		return nil, WrapErrf(ErrContentEncoding, "compress body with %s", encoding)
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, WrapErrf(err, "compress body with %s failed", encoding)
+	}
+	if err := w.Close(); err != nil {
+		return nil, WrapErrf(err, "compress body with %s failed", encoding)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeContentEncoding decompress the content with Content-Encoding header,
+// which may have multiple encodings applied in order, like "gzip, br". Each
+// decoded content is limited to maxSize bytes, zero means the default size
+// and negative means no limit.
+func decodeContentEncoding(contentEncoding string, content []byte, maxSize int64) ([]byte, error) {
+	if maxSize == 0 {
+		maxSize = defaultMaxDecompressedSize
+	}
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if encoding == "" || encoding == "identity" {
+			continue
+		}
+		decoded, err := decodeContentWith(encoding, content, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		content = decoded
+	}
+	return content, nil
+}
+
+// decodeContentWith decompress the content with one encoding, it stops
+// reading when the decoded content exceeds maxSize if it is positive.
+func decodeContentWith(encoding string, content []byte, maxSize int64) ([]byte, error) {
+	var r io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, WrapErr(err, "decode gzip content failed")
+		}
+		defer gr.Close()
+		r = gr
+	case "deflate":
+		// deflate should be zlib format, but some servers send raw deflate.
+		zr, err := zlib.NewReader(bytes.NewReader(content))
+		if err != nil {
+			fr := flate.NewReader(bytes.NewReader(content))
+			defer fr.Close()
+			r = fr
+		} else {
+			defer zr.Close()
+			r = zr
+		}
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(content))
+	case "zstd":
+		decoder, ok := zstdDecoders.Get().(*zstd.Decoder)
+		if !ok {
+			var err error
+			if decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1)); err != nil {
+				return nil, WrapErr(err, "new zstd decoder failed")
+			}
+		}
+		if err := decoder.Reset(bytes.NewReader(content)); err != nil {
+			return nil, WrapErr(err, "decode zstd content failed")
+		}
+		defer func() {
+			_ = decoder.Reset(nil) // release the content before it is pooled
+			zstdDecoders.Put(decoder)
+		}()
+		r = decoder
+	default:
+		return nil, WrapErrf(ErrContentEncoding, "decode content with %s", encoding)
+	}
+
+	if maxSize > 0 {
+		r = io.LimitReader(r, maxSize+1)
+	}
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) { // Ignore Unexpected EOF error
+		return nil, WrapErrf(err, "decode %s content failed", encoding)
+	}
+	if maxSize > 0 && int64(len(decoded)) > maxSize {
+		return nil, WrapErrf(ErrDecompressedSize, "%s content exceeds %d bytes", encoding, maxSize)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,143 @@
+package direwolf
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestCompressServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" { // echo the decompressed request body
+			body, _ := ioutil.ReadAll(r.Body)
+			decoded, err := decodeContentEncoding(r.Header.Get("Content-Encoding"), body, 0)
+			if err != nil {
+				w.WriteHeader(400)
+				return
+			}
+			_, _ = w.Write(decoded)
+			return
+		}
+
+		encoding := r.URL.Query().Get("encoding")
+		content, err := encodeContent(encoding, []byte(strings.Repeat("direwolf ", 100)))
+		if err != nil {
+			content = []byte("raw")
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		_, _ = w.Write(content)
+	}))
+}
+
+func TestDecompressResponse(t *testing.T) {
+	ts := newTestCompressServer()
+	defer ts.Close()
+
+	session := NewSession()
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		resp, err := session.Get(ts.URL, NewParams("encoding", encoding))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != strings.Repeat("direwolf ", 100) {
+			t.Fatalf("decompress %s response failed.", encoding)
+		}
+		if resp.ContentEncoding != encoding || resp.DecompressedSize != 900 || resp.CompressedSize >= 900 {
+			t.Fatalf("response %s sizes failed: %d %d", encoding, resp.CompressedSize, resp.DecompressedSize)
+		}
+		if resp.Headers.Get("X-Accept-Encoding") != acceptEncoding {
+			t.Fatal("default Accept-Encoding failed.")
+		}
+	}
+
+	// Accept-Encoding copied from browser should not break decompression.
+	resp, err := session.Get(ts.URL, NewParams("encoding", "gzip"), NewHeaders("Accept-Encoding", "gzip, deflate, br"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != strings.Repeat("direwolf ", 100) || resp.Headers.Get("X-Accept-Encoding") != "gzip, deflate, br" {
+		t.Fatal("decompress with user Accept-Encoding failed.")
+	}
+
+	// Unknown encoding keeps the raw content.
+	resp, err = session.Get(ts.URL, NewParams("encoding", "sdch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "raw" || resp.Headers.Get("Content-Encoding") != "sdch" {
+		t.Fatal("unknown encoding should keep raw content.")
+	}
+}
+
+func TestDecodeMultipleEncodings(t *testing.T) {
+	gzipped, _ := encodeContent("gzip", []byte("direwolf"))
+	content, _ := encodeContent("br", gzipped)
+	decoded, err := decodeContentEncoding("gzip, br", content, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != "direwolf" {
+		t.Fatal("decode multiple encodings failed.")
+	}
+}
+
+func TestDecompressedSizeLimit(t *testing.T) {
+	ts := newTestCompressServer()
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.MaxDecompressedSize = 100
+	session := NewSession(options)
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		if _, err := session.Get(ts.URL, NewParams("encoding", encoding)); !errors.Is(err, ErrDecompressedSize) {
+			t.Fatalf("decompress %s should be limited: %v", encoding, err)
+		}
+	}
+
+	options.MaxDecompressedSize = -1
+	resp, err := NewSession(options).Get(ts.URL, NewParams("encoding", "zstd"))
+	if err != nil || resp.DecompressedSize != 900 {
+		t.Fatal("negative MaxDecompressedSize should not limit: ", err)
+	}
+
+	// The pooled zstd decoders are used concurrently.
+	content, _ := encodeContent("zstd", []byte(strings.Repeat("direwolf ", 100)))
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			decoded, err := decodeContentEncoding("zstd", content, 900)
+			if err == nil && len(decoded) != 900 {
+				err = errors.New("wrong decoded size")
+			}
+			done <- err
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompressBody(t *testing.T) {
+	ts := newTestCompressServer()
+	defer ts.Close()
+
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		resp, err := Post(ts.URL, Body("winter is coming"), CompressBody(encoding))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != "winter is coming" {
+			t.Fatalf("compress body with %s failed.", encoding)
+		}
+	}
+
+	if _, err := NewRequest("POST", ts.URL, CompressBody("lzma")); !errors.Is(err, ErrContentEncoding) {
+		t.Fatal("CompressBody should fail with unknown encoding.")
+	}
+}
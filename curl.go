@@ -0,0 +1,510 @@
+package direwolf
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrCurlCommand is returned by ParseCurl when the command can`t be parsed.
+var ErrCurlCommand = errors.New("invalid curl command")
+
+// ParseCurl construct a Request from a curl command line, such as the one
+// copied by "Copy as cURL" of browsers. Shell quoting like 'single',
+// "double", $'ANSI-C' and backslash escapes is handled.
+//
+// These options of curl are supported:
+//
+//	-X, --request: Method for the request.
+//	-H, --header: Headers to send.
+//	-d, --data, --data-raw, --data-binary, --data-ascii: Body to send, as is.
+//	--data-urlencode: Body to send, url encoded.
+//	-F, --form: MultipartForm to send.
+//	-G, --get: Put the data into query string.
+//	-b, --cookie: Cookies to send.
+//	-u, --user: Basic authorization.
+//	-A, --user-agent, -e, --referer: Headers to send.
+//	-x, --proxy: Proxy to use.
+//	-L, --location, --max-redirs: RedirectNum of the request. Redirect is banned without -L or
+//	with --max-redirs 0, and --max-redirs -1 means unlimited, just like curl.
+//	-m, --max-time: Timeout of the request.
+//	-k, --insecure: InsecureSkipVerify of the request.
+//	-I, --head: Send a HEAD request.
+//	--compressed: Direwolf decodes compressed response by default, so it is ignored.
+//
+// Options which only change the output of curl, like -s and -v, are ignored.
+// Other options return an error wrapping ErrCurlCommand.
+func ParseCurl(cmd string) (*Request, error) {
+	args, err := splitCommand(cmd)
+	if err != nil {
+		return nil, WrapErr(err, "split curl command failed")
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, WrapErr(ErrCurlCommand, "command must start with curl")
+	}
+
+	p := &curlParser{headers: http.Header{}}
+	if err := p.parse(args[1:]); err != nil {
+		return nil, err
+	}
+	return p.build()
+}
+
+// curlParser holds the state when parsing curl options.
+type curlParser struct {
+	method    string
+	url       string
+	headers   http.Header
+	data      []string
+	form      *MultipartForm
+	get       bool
+	head      bool
+	cookies   Cookies
+	proxy     *Proxy
+	location  bool
+	maxRedirs *int
+	timeout   int
+	insecure  bool
+}
+
+// curlArgOptions is the options which take an argument, short option maps to long option.
+var curlArgOptions = map[string]string{
+	"-X": "--request", "-H": "--header", "-d": "--data", "-F": "--form",
+	"-b": "--cookie", "-u": "--user", "-A": "--user-agent", "-e": "--referer",
+	"-x": "--proxy", "-m": "--max-time",
+	"--request": "--request", "--header": "--header", "--data": "--data",
+	"--data-raw": "--data-raw", "--data-binary": "--data-binary", "--data-ascii": "--data",
+	"--data-urlencode": "--data-urlencode", "--form": "--form", "--cookie": "--cookie",
+	"--user": "--user", "--user-agent": "--user-agent", "--referer": "--referer",
+	"--proxy": "--proxy", "--max-time": "--max-time", "--max-redirs": "--max-redirs",
+	"--url": "--url",
+}
+
+// curlFlagOptions is the options without argument, short option maps to long option.
+var curlFlagOptions = map[string]string{
+	"-G": "--get", "-L": "--location", "-k": "--insecure", "-I": "--head",
+	"-s": "--silent", "-S": "--show-error", "-v": "--verbose", "-i": "--include",
+	"--get": "--get", "--location": "--location", "--insecure": "--insecure", "--head": "--head",
+	"--compressed": "--compressed", "--silent": "--silent", "--show-error": "--show-error",
+	"--verbose": "--verbose", "--include": "--include",
+}
+
+// parse handles all the arguments after curl.
+func (p *curlParser) parse(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if p.url != "" {
+				return WrapErrf(ErrCurlCommand, "unexpected argument: %s", arg)
+			}
+			p.url = arg
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		if strings.HasPrefix(arg, "--") {
+			if index := strings.Index(arg, "="); index > 0 {
+				name, value, hasValue = arg[:index], arg[index+1:], true
+			}
+		} else if len(arg) > 2 {
+			// Short options can be combined, like -sSL, or followed by argument, like -XPOST.
+			name = arg[:2]
+			if _, ok := curlArgOptions[name]; ok {
+				value, hasValue = arg[2:], true
+			} else {
+				for _, c := range arg[1:] {
+					long, ok := curlFlagOptions["-"+string(c)]
+					if !ok {
+						return WrapErrf(ErrCurlCommand, "unsupported option: %s", arg)
+					}
+					p.flag(long)
+				}
+				continue
+			}
+		}
+
+		if long, ok := curlFlagOptions[name]; ok {
+			p.flag(long)
+			continue
+		}
+		long, ok := curlArgOptions[name]
+		if !ok {
+			return WrapErrf(ErrCurlCommand, "unsupported option: %s", name)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return WrapErrf(ErrCurlCommand, "option %s needs an argument", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err := p.option(long, value); err != nil {
+			return err
+		}
+	}
+	if p.url == "" {
+		return WrapErr(ErrCurlCommand, "no URL specified")
+	}
+	return nil
+}
+
+// flag handles the options without argument.
+func (p *curlParser) flag(name string) {
+	switch name {
+	case "--get":
+		p.get = true
+	case "--location":
+		p.location = true
+	case "--insecure":
+		p.insecure = true
+	case "--head":
+		p.head = true
+	}
+}
+
+// option handles the options with argument.
+func (p *curlParser) option(name, value string) error {
+	switch name {
+	case "--url":
+		p.url = value
+	case "--request":
+		p.method = strings.ToUpper(value)
+	case "--header":
+		if index := strings.Index(value, ":"); index > 0 {
+			p.headers.Add(strings.TrimSpace(value[:index]), strings.TrimSpace(value[index+1:]))
+		} else if strings.HasSuffix(value, ";") { // "Name;" sends a header with empty value.
+			p.headers.Add(strings.TrimSuffix(value, ";"), "")
+		} else {
+			return WrapErrf(ErrCurlCommand, "invalid header: %s", value)
+		}
+	case "--data", "--data-binary":
+		if strings.HasPrefix(value, "@") {
+			content, err := ioutil.ReadFile(value[1:])
+			if err != nil {
+				return WrapErr(err, "read data file failed")
+			}
+			value = string(content)
+			if name == "--data" { // curl strips newlines from files posted by -d
+				value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+			}
+		}
+		p.data = append(p.data, value)
+	case "--data-raw":
+		p.data = append(p.data, value)
+	case "--data-urlencode":
+		encoded, err := curlURLEncode(value)
+		if err != nil {
+			return err
+		}
+		p.data = append(p.data, encoded)
+	case "--form":
+		return p.formPart(value)
+	case "--cookie":
+		if !strings.Contains(value, "=") {
+			return WrapErrf(ErrCurlCommand, "cookie file is not supported: %s", value)
+		}
+		for _, pair := range strings.Split(value, ";") {
+			pair = strings.TrimSpace(pair)
+			if index := strings.Index(pair, "="); index > 0 {
+				p.cookies = append(p.cookies, &http.Cookie{Name: pair[:index], Value: pair[index+1:]})
+			}
+		}
+	case "--user":
+		auth := base64.StdEncoding.EncodeToString([]byte(value))
+		p.headers.Set("Authorization", "Basic "+auth)
+	case "--user-agent":
+		p.headers.Set("User-Agent", value)
+	case "--referer":
+		p.headers.Set("Referer", value)
+	case "--proxy":
+		if !strings.Contains(value, "://") {
+			value = "http://" + value
+		}
+		p.proxy = &Proxy{HTTP: value, HTTPS: value}
+	case "--max-time":
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return WrapErrf(ErrCurlCommand, "invalid max time: %s", value)
+		}
+		p.timeout = int(math.Ceil(seconds))
+	case "--max-redirs":
+		num, err := strconv.Atoi(value)
+		if err != nil || num < -1 {
+			return WrapErrf(ErrCurlCommand, "invalid max redirs: %s", value)
+		}
+		p.maxRedirs = &num
+	}
+	return nil
+}
+
+// formPart add a part of -F option to MultipartForm. Value is like:
+//
+//	name=content
+//	name=@file;type=text/plain;filename=a.txt
+//	name=<file
+func (p *curlParser) formPart(value string) error {
+	index := strings.Index(value, "=")
+	if index <= 0 {
+		return WrapErrf(ErrCurlCommand, "invalid form: %s", value)
+	}
+	if p.form == nil {
+		p.form = NewMultipartForm()
+	}
+	key, content := value[:index], value[index+1:]
+
+	switch {
+	case strings.HasPrefix(content, "@"):
+		params := strings.Split(content[1:], ";")
+		var contentType, fileName string
+		for _, param := range params[1:] {
+			if strings.HasPrefix(param, "type=") {
+				contentType = strings.TrimPrefix(param, "type=")
+			} else if strings.HasPrefix(param, "filename=") {
+				fileName = strings.Trim(strings.TrimPrefix(param, "filename="), `"`)
+			}
+		}
+		return p.form.WriteFile(key, params[0], &PartOptions{FileName: fileName, ContentType: contentType})
+	case strings.HasPrefix(content, "<"):
+		data, err := ioutil.ReadFile(content[1:])
+		if err != nil {
+			return WrapErr(err, "read form file failed")
+		}
+		return p.form.WriteField(key, string(data))
+	default:
+		return p.form.WriteField(key, content)
+	}
+}
+
+// build construct the Request with parsed options.
+func (p *curlParser) build() (*Request, error) {
+	method := p.method
+	if method == "" {
+		switch {
+		case p.head:
+			method = "HEAD"
+		case p.form != nil || (len(p.data) > 0 && !p.get):
+			method = "POST"
+		default:
+			method = "GET"
+		}
+	}
+
+	req, err := NewRequest(method, p.url)
+	if err != nil {
+		return nil, err
+	}
+	req.Cookies = p.cookies
+	req.Proxy = p.proxy
+	req.Timeout = p.timeout
+	req.InsecureSkipVerify = p.insecure
+	switch {
+	case !p.location:
+		req.RedirectNum = -1 // curl does not follow redirects without -L
+	case p.maxRedirs == nil:
+	case *p.maxRedirs == 0:
+		req.RedirectNum = -1
+	case *p.maxRedirs == -1: // unlimited
+		req.RedirectNum = math.MaxInt32
+	default:
+		req.RedirectNum = *p.maxRedirs
+	}
+
+	data := strings.Join(p.data, "&")
+	switch {
+	case p.form != nil:
+		if len(p.data) > 0 {
+			return nil, WrapErr(ErrCurlCommand, "-d and -F can`t be used together")
+		}
+		if err := p.form.Close(); err != nil {
+			return nil, WrapErr(err, "close multipart form failed")
+		}
+		req.MultipartForm = p.form
+	case len(p.data) > 0 && p.get:
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, WrapErr(err, "URL error")
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += data
+		req.URL = u.String()
+	case len(p.data) > 0:
+		contentType := p.headers.Get("Content-Type")
+		mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			req.JsonBody = []byte(data)
+		} else {
+			if contentType == "" { // curl posts -d data as form by default
+				p.headers.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			req.Body = []byte(data) // keep the bytes as curl sends them
+		}
+	}
+
+	if len(p.headers) > 0 {
+		req.Headers = p.headers
+	}
+	return req, nil
+}
+
+// curlURLEncode encodes the argument of --data-urlencode. Value is like:
+//
+//	content
+//	=content
+//	name=content
+//	@file
+//	name@file
+func curlURLEncode(value string) (string, error) {
+	// Like curl, '=' is looked for first, so the name of name=content can
+	// contain '@'.
+	var name, content string
+	if index := strings.IndexByte(value, '='); index >= 0 {
+		name, content = value[:index], value[index+1:]
+	} else if index := strings.IndexByte(value, '@'); index >= 0 {
+		data, err := ioutil.ReadFile(value[index+1:])
+		if err != nil {
+			return "", WrapErr(err, "read data file failed")
+		}
+		name, content = value[:index], string(data)
+	} else {
+		content = value
+	}
+	if name == "" {
+		return url.QueryEscape(content), nil
+	}
+	return name + "=" + url.QueryEscape(content), nil
+}
+
+// splitCommand splits command line into arguments, handling the quoting
+// and escaping rules of POSIX shell, and $'...' ANSI-C quoting of bash.
+func splitCommand(cmd string) ([]string, error) {
+	var args []string
+	var buf strings.Builder
+	inArg := false
+
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, buf.String())
+				buf.Reset()
+				inArg = false
+			}
+		case c == '\\':
+			if i+1 < len(cmd) {
+				i++
+				if cmd[i] == '\n' { // line continuation
+					continue
+				}
+				buf.WriteByte(cmd[i])
+			}
+			inArg = true
+		case c == '\'':
+			end := strings.IndexByte(cmd[i+1:], '\'')
+			if end < 0 {
+				return nil, WrapErr(ErrCurlCommand, "unterminated single quote")
+			}
+			buf.WriteString(cmd[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '$' && i+1 < len(cmd) && cmd[i+1] == '\'':
+			n, err := ansiCQuote(cmd[i+2:], &buf)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(cmd) && cmd[i] != '"'; i++ {
+				// In double quotes, backslash only escapes $ ` " \ and newline.
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte("$`\"\\\n", cmd[i+1]) >= 0 {
+					i++
+					if cmd[i] == '\n' {
+						continue
+					}
+				}
+				buf.WriteByte(cmd[i])
+			}
+			if i >= len(cmd) {
+				return nil, WrapErr(ErrCurlCommand, "unterminated double quote")
+			}
+			inArg = true
+		default:
+			buf.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+// ansiCQuote decodes the content of $'...' into buf. s starts after $'.
+// It returns the index of the closing quote in s.
+func ansiCQuote(s string, buf *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			return i, nil
+		}
+		if c != '\\' || i+1 >= len(s) {
+			buf.WriteByte(c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			buf.WriteByte('\n')
+		case 't':
+			buf.WriteByte('\t')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'e', 'E':
+			buf.WriteByte(0x1b)
+		case 'f':
+			buf.WriteByte('\f')
+		case 'v':
+			buf.WriteByte('\v')
+		case 'x', 'u', 'U':
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			end := i + 1
+			for end < len(s) && end < i+1+size && isHexDigit(s[end]) {
+				end++
+			}
+			if end == i+1 {
+				buf.WriteByte('\\')
+				buf.WriteByte(s[i])
+				continue
+			}
+			code, _ := strconv.ParseUint(s[i+1:end], 16, 32)
+			if s[i] == 'x' {
+				buf.WriteByte(byte(code))
+			} else if utf8.ValidRune(rune(code)) {
+				buf.WriteRune(rune(code))
+			}
+			i = end - 1
+		default: // \\ \' \" and others
+			buf.WriteByte(s[i])
+		}
+	}
+	return 0, WrapErr(ErrCurlCommand, "unterminated $' quote")
+}
+
+// isHexDigit check whether c is a hexadecimal digit.
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
@@ -0,0 +1,178 @@
+package direwolf
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		cmd  string
+		args []string
+	}{
+		{`curl 'http://a.com/?q=1' -H "X-A: \"b\""`, []string{"curl", "http://a.com/?q=1", "-H", `X-A: "b"`}},
+		{"curl a\\ b \\\n -d x", []string{"curl", "a b", "-d", "x"}},
+		{`curl $'it\'s\n\x41中'`, []string{"curl", "it's\nA中"}},
+		{`curl "a"'b'c`, []string{"curl", "abc"}},
+	}
+	for _, c := range cases {
+		args, err := splitCommand(c.cmd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalStrings(args, c.args) {
+			t.Fatalf("splitCommand(%q) = %q, want %q", c.cmd, args, c.args)
+		}
+	}
+
+	if _, err := splitCommand(`curl 'abc`); !errors.Is(err, ErrCurlCommand) {
+		t.Fatal("splitCommand should fail with unterminated quote.")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseCurl(t *testing.T) {
+	req, err := ParseCurl(`curl 'https://example.com/api?x=1' \
+		-H 'accept: application/json' \
+		-H 'content-type: application/json' \
+		-b 'session=abc; theme=dark' \
+		--data-raw '{"name":"direwolf"}' \
+		-u user:pass -x 127.0.0.1:8080 --max-time 2.5 -sSL --compressed -k`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "POST" || req.URL != "https://example.com/api?x=1" {
+		t.Fatal("ParseCurl method or url failed.")
+	}
+	if req.Headers.Get("Accept") != "application/json" || req.Headers.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+		t.Fatal("ParseCurl headers failed.")
+	}
+	if string(req.JsonBody) != `{"name":"direwolf"}` {
+		t.Fatal("ParseCurl json body failed.")
+	}
+	if len(req.Cookies) != 2 || req.Cookies[1].Name != "theme" || req.Cookies[1].Value != "dark" {
+		t.Fatal("ParseCurl cookies failed.")
+	}
+	if req.Proxy.HTTPS != "http://127.0.0.1:8080" {
+		t.Fatal("ParseCurl proxy failed.")
+	}
+	if req.Timeout != 3 || req.RedirectNum != 0 || !req.InsecureSkipVerify {
+		t.Fatal("ParseCurl options failed.")
+	}
+
+	req, err = ParseCurl(`curl -XPUT http://example.com -d a=1 -d 'b=2&b=3' --data-urlencode 'c=x y'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "PUT" || string(req.Body) != "a=1&b=2&b=3&c=x+y" ||
+		req.Headers.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Fatal("ParseCurl form data failed.")
+	}
+	if req.RedirectNum != -1 {
+		t.Fatal("ParseCurl should ban redirect without -L.")
+	}
+
+	req, err = ParseCurl(`curl http://example.com -d 'b=2&a=%7e&invalid' -L --max-redirs 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req.Body) != "b=2&a=%7e&invalid" || req.RedirectNum != -1 {
+		t.Fatal("ParseCurl should keep the data and ban redirect with --max-redirs 0: ", string(req.Body), req.RedirectNum)
+	}
+	req, err = ParseCurl(`curl http://example.com -L --max-redirs -1`)
+	if err != nil || req.RedirectNum <= 10 {
+		t.Fatal("ParseCurl should allow unlimited redirects with --max-redirs -1.")
+	}
+
+	req, err = ParseCurl(`curl http://example.com --data-urlencode 'a@b=c d'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req.Body) != "a@b=c+d" {
+		t.Fatal("ParseCurl should look for '=' before '@' in --data-urlencode: ", string(req.Body))
+	}
+
+	req, err = ParseCurl(`curl -G http://example.com/?x=1 -d a=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "GET" || req.URL != "http://example.com/?x=1&a=1" {
+		t.Fatal("ParseCurl -G failed.")
+	}
+
+	req, err = ParseCurl(`curl http://example.com --data-binary 'plain text'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(req.Body) != "plain text" || req.Headers.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Fatal("ParseCurl body failed.")
+	}
+
+	if _, err := ParseCurl(`curl --unknown http://example.com`); !errors.Is(err, ErrCurlCommand) {
+		t.Fatal("ParseCurl should fail with unknown option.")
+	}
+	for _, cmd := range []string{
+		`curl http://example.com --connect-timeout 3`,
+		`curl http://example.com -o out.html`,
+		`curl http://example.com -L --max-redirs -2`,
+	} {
+		if _, err := ParseCurl(cmd); !errors.Is(err, ErrCurlCommand) {
+			t.Fatal("ParseCurl should fail with unsupported option: ", cmd)
+		}
+	}
+	if _, err := ParseCurl(`wget http://example.com`); !errors.Is(err, ErrCurlCommand) {
+		t.Fatal("ParseCurl should fail without curl.")
+	}
+}
+
+func TestParseCurlSend(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		_, _ = w.Write([]byte(r.FormValue("name") + ":" + header.Filename + ":" +
+			header.Header.Get("Content-Type") + ":" + string(content)))
+	}))
+	defer ts.Close()
+
+	filePath := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(filePath, []byte("file content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := ParseCurl(`curl -k ` + ts.URL + ` -F name=direwolf -F "file=@` + filePath + `;type=text/plain;filename=a.txt"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewSession().Send(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "direwolf:a.txt:text/plain:file content" {
+		t.Fatal("ParseCurl multipart form failed: ", resp.Text())
+	}
+
+	req.InsecureSkipVerify = false
+	if _, err := NewSession().Send(req); err == nil {
+		t.Fatal("Request should fail to verify the certificate.")
+	}
+}
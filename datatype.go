@@ -27,7 +27,8 @@ func (options Body) bindRequest(request *Request) error {
 // JsonBody is the json data you want to post.
 type JsonBody []byte
 
-// NewJsonBody new a json type body.
+// NewJsonBody new a json type body. It returns nil if v can not be marshaled,
+// use PostJSON to get the error.
 func NewJsonBody(v interface{}) JsonBody {
 	body, err := jsoniter.Marshal(v)
 	if err != nil {
@@ -66,6 +67,19 @@ func (options Timeout) bindRequest(request *Request) error {
 	return nil
 }
 
+// InsecureSkipVerify controls whether the request verifies the server's
+// certificate chain and host name. Just like the -k option of curl.
+//
+// If InsecureSkipVerify is true, the request accepts any certificate
+// presented by the server. This should be used only for testing.
+type InsecureSkipVerify bool
+
+// RequestOption interface method, bind request option to request.
+func (options InsecureSkipVerify) bindRequest(request *Request) error {
+	request.InsecureSkipVerify = bool(options)
+	return nil
+}
+
 // Proxy is the proxy server address, like "http://127.0.0.1:1080".
 // You can set different proxies for HTTP and HTTPS sites.
 type Proxy struct {
@@ -250,7 +264,7 @@ type Headers struct {
 
 // RequestOption interface method, bind request option to request.
 func (options Headers) bindRequest(request *Request) error {
-	request.Headers = options.Header
+	addHeaders(request, options.Header)
 	return nil
 }
 
@@ -0,0 +1,306 @@
+package direwolf
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrLocalAddr is returned when the local address or interface is invalid.
+var ErrLocalAddr = errors.New("invalid local address")
+
+// ErrDialOptions is returned when the dial options of SessionOptions conflict.
+var ErrDialOptions = errors.New("conflicting dial options")
+
+// unixSocketKey is the context key of the unix socket path of request.
+type unixSocketKey struct{}
+
+// dialer dials the connections of Session. It dials the unix socket of
+// request if there is one, or dials TCP connection by the network of
+// SessionOptions.
+type dialer struct {
+	netDialer   *net.Dialer
+	dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	network     string    // tcp4 or tcp6 if the ip version is forced
+	resolver    *resolver // nil if host names are resolved by net.Dialer
+}
+
+// newDialer new a dialer from SessionOptions.
+func newDialer(options *SessionOptions) (*dialer, error) {
+	var netDialer net.Dialer
+	if options.Dialer != nil {
+		netDialer = *options.Dialer
+	} else {
+		netDialer.Timeout = options.DialTimeout
+		netDialer.KeepAlive = options.DialKeepAlive
+	}
+
+	d := &dialer{netDialer: &netDialer}
+	if options.ForceIPv4 && options.ForceIPv6 {
+		return nil, WrapErr(ErrDialOptions, "ForceIPv4 and ForceIPv6 can not be both set")
+	}
+	if options.ForceIPv4 {
+		d.network = "tcp4"
+	} else if options.ForceIPv6 {
+		d.network = "tcp6"
+	}
+	if options.LocalAddr != "" {
+		ip, err := localIP(options.LocalAddr, d.network)
+		if err != nil {
+			return nil, err
+		}
+		netDialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	d.dialContext = netDialer.DialContext
+	if options.DialContext != nil {
+		d.dialContext = options.DialContext
+	}
+	r, err := newResolver(options)
+	if err != nil {
+		return nil, err
+	}
+	d.resolver = r
+	return d, nil
+}
+
+// Dial dials the addr, it is used by the socks5 proxy of tunnelTransport,
+// which dials by DialContext when the context is given.
+func (d *dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext dials the unix socket in ctx, or the addr.
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if socket, ok := ctx.Value(unixSocketKey{}).(string); ok {
+		unixDialer := net.Dialer{Timeout: d.netDialer.Timeout}
+		return unixDialer.DialContext(ctx, "unix", socket)
+	}
+	if d.network != "" && network == "tcp" {
+		network = d.network
+	}
+	if d.resolver == nil {
+		return d.dialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialContext(ctx, network, addr)
+	}
+	ips, err := d.resolver.lookup(ctx, network, host, port)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return d.dialIPs(ctx, network, ips, port)
+}
+
+// dialIPs dials the resolved ips like net.Dialer does for host names. The ips
+// share the dial timeout, and when there are ips of both families, the ips
+// of the other family race with the first after FallbackDelay (Happy
+// Eyeballs, RFC 6555).
+func (d *dialer) dialIPs(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	if d.netDialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.netDialer.Timeout)
+		defer cancel()
+	}
+	if !d.netDialer.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, d.netDialer.Deadline)
+		defer cancel()
+	}
+
+	var primaries, fallbacks []net.IP
+	primaryIPv4 := ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == primaryIPv4 {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	if len(fallbacks) == 0 || d.netDialer.FallbackDelay < 0 {
+		return d.dialSerial(ctx, network, ips, port)
+	}
+
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan dialResult) // unbuffered, the losers close their conns
+	returned := make(chan struct{})
+	defer close(returned)
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	race := func(ips []net.IP, primary bool) {
+		conn, err := d.dialSerial(raceCtx, network, ips, port)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primary}:
+		case <-returned:
+			if conn != nil {
+				_ = conn.Close()
+			}
+		}
+	}
+
+	go race(primaries, true)
+	fallbackDelay := d.netDialer.FallbackDelay
+	if fallbackDelay == 0 {
+		fallbackDelay = 300 * time.Millisecond // the default of net.Dialer
+	}
+	fallbackTimer := time.NewTimer(fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr error
+	primaryDone, fallbackStarted, fallbackDone := false, false, false
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				go race(fallbacks, false)
+			}
+		case res := <-results:
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryDone, primaryErr = true, res.err
+			} else {
+				fallbackDone = true
+			}
+			if primaryDone && fallbackDone {
+				return nil, primaryErr
+			}
+			if res.primary && !fallbackStarted {
+				// Start the fallback at once if the primaries failed.
+				fallbackStarted = true
+				go race(fallbacks, false)
+			}
+		}
+	}
+}
+
+// dialSerial dials the ips in order until one is connected. Like net.Dialer,
+// each ip gets a part of the time left before the deadline of ctx, so one
+// unreachable ip does not use up the dial timeout.
+func (d *dialer) dialSerial(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	var firstErr error
+	for i, ip := range ips {
+		if err := ctx.Err(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+		dialCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithDeadline(ctx, partialDeadline(time.Now(), deadline, len(ips)-i))
+			defer cancel()
+		}
+		conn, err := d.dialContext(dialCtx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// partialDeadline returns the deadline of one of the addrs left to dial, it
+// splits the time left evenly, but gives each addr at least 2 seconds if
+// there is enough time, the same as net.Dialer.
+func partialDeadline(now, deadline time.Time, addrsRemaining int) time.Time {
+	timeRemaining := deadline.Sub(now)
+	if timeRemaining <= 0 {
+		return deadline
+	}
+	timeout := timeRemaining / time.Duration(addrsRemaining)
+	const saneMinimum = 2 * time.Second
+	if timeout < saneMinimum {
+		if timeRemaining < saneMinimum {
+			timeout = timeRemaining
+		} else {
+			timeout = saneMinimum
+		}
+	}
+	return now.Add(timeout)
+}
+
+// localIP returns the ip of local address, addr can be an ip, or the name of
+// network interface, the first address of the interface which matches the
+// network is used.
+func localIP(addr, network string) (net.IP, error) {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip, nil
+	}
+	iface, err := net.InterfaceByName(addr)
+	if err != nil {
+		return nil, WrapErrf(ErrLocalAddr, "local address: %s", addr)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, WrapErrf(ErrLocalAddr, "local address: %s", addr)
+	}
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		isIPv4 := ipNet.IP.To4() != nil
+		if network == "" || (network == "tcp4") == isIPv4 {
+			return ipNet.IP, nil
+		}
+	}
+	return nil, WrapErrf(ErrLocalAddr, "no usable address on interface: %s", addr)
+}
+
+// UnixSocket is the path of unix domain socket which the request is sent to,
+// like the --unix-socket of curl. The host of url is only used as Host header.
+type UnixSocket string
+
+// RequestOption interface method, bind request option to request.
+func (options UnixSocket) bindRequest(request *Request) error {
+	request.UnixSocket = string(options)
+	return nil
+}
+
+// splitUnixSocketURL splits the url like "http+unix://%2Fvar%2Frun%2Fdocker.sock/info"
+// or "unix://%2Fvar%2Frun%2Fdocker.sock/info" into the socket path and a http
+// url "http://localhost/info". ok is false if it is not a unix socket url.
+func splitUnixSocketURL(URL string) (socket, httpURL string, ok bool) {
+	var rest string
+	if strings.HasPrefix(URL, "http+unix://") {
+		rest = URL[len("http+unix://"):]
+	} else if strings.HasPrefix(URL, "unix://") {
+		rest = URL[len("unix://"):]
+	} else {
+		return "", URL, false
+	}
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	socket, err := url.PathUnescape(rest[:end])
+	if err != nil || socket == "" {
+		return "", URL, false
+	}
+	return socket, "http://localhost" + rest[end:], true
+}
+
+// unixSocketHost returns the host of url to connect the unix socket. The
+// Transport pools connections by host, so each socket has a distinct host.
+func unixSocketHost(socket string) string {
+	return hex.EncodeToString([]byte(socket)) + ".sock"
+}
@@ -0,0 +1,144 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "direwolf.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + " " + r.URL.String()))
+	}))
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	session := NewSession()
+	resp, err := session.Get("http+unix://"+url.PathEscape(socket)+"/info", NewParams("a", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "localhost /info?a=1" {
+		t.Fatal("http+unix url failed: ", resp.Text())
+	}
+
+	resp, err = session.Get("http://docker/v1/containers", UnixSocket(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "docker /v1/containers" {
+		t.Fatal("UnixSocket failed: ", resp.Text())
+	}
+}
+
+func TestSplitUnixSocketURL(t *testing.T) {
+	socket, httpURL, ok := splitUnixSocketURL("unix://%2Fvar%2Frun%2Fdocker.sock?all=1")
+	if !ok || socket != "/var/run/docker.sock" || httpURL != "http://localhost?all=1" {
+		t.Fatal("splitUnixSocketURL failed: ", socket, httpURL)
+	}
+	if _, _, ok := splitUnixSocketURL("http://localhost/"); ok {
+		t.Fatal("http url is not unix socket url.")
+	}
+}
+
+func TestSessionDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.RemoteAddr))
+	}))
+	defer ts.Close()
+
+	var networks []string
+	options := DefaultSessionOptions()
+	options.ForceIPv4 = true
+	options.LocalAddr = "127.0.0.1"
+	options.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		networks = append(networks, network)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	session := NewSession(options)
+	if _, err := session.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 1 || networks[0] != "tcp4" {
+		t.Fatal("DialContext should be called with tcp4: ", networks)
+	}
+
+	options = DefaultSessionOptions()
+	options.LocalAddr = "no-such-interface"
+	if NewSession(options) != nil {
+		t.Fatal("NewSession should fail with invalid LocalAddr.")
+	}
+
+	options = DefaultSessionOptions()
+	options.ForceIPv4 = true
+	options.ForceIPv6 = true
+	if _, err := newDialer(options); !errors.Is(err, ErrDialOptions) {
+		t.Fatal("ForceIPv4 and ForceIPv6 should conflict: ", err)
+	}
+	if NewSession(options) != nil {
+		t.Fatal("NewSession should fail with ForceIPv4 and ForceIPv6.")
+	}
+}
+
+func TestDialIPs(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	d := &dialer{netDialer: &net.Dialer{Timeout: 5 * time.Second, FallbackDelay: 50 * time.Millisecond}}
+	d.dialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, _ := net.SplitHostPort(addr); host != "127.0.0.1" { // blackholed
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+
+	start := time.Now()
+	conn, err := d.dialIPs(context.Background(), "tcp", []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("127.0.0.1")}, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("IPv4 should race with the blackholed IPv6 after FallbackDelay: ", elapsed)
+	}
+
+	d.netDialer.Timeout = 300 * time.Millisecond
+	start = time.Now()
+	ips := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3")}
+	if _, err := d.dialIPs(context.Background(), "tcp", ips, port); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("dial should fail by the timeout: ", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("the ips should share the dial timeout: ", elapsed)
+	}
+}
+
+func TestPartialDeadline(t *testing.T) {
+	now := time.Now()
+	if partialDeadline(now, now.Add(10*time.Second), 2) != now.Add(5*time.Second) {
+		t.Fatal("the time left should be split between the addrs.")
+	}
+	if partialDeadline(now, now.Add(3*time.Second), 3) != now.Add(2*time.Second) {
+		t.Fatal("each addr should get at least 2 seconds.")
+	}
+	if partialDeadline(now, now.Add(time.Second), 3) != now.Add(time.Second) {
+		t.Fatal("the addr should get all the time left if it is less than 2 seconds.")
+	}
+}
@@ -0,0 +1,139 @@
+package direwolftest
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Expectation describes the request expected to be received by MockTransport.
+// Zero value fields are not checked.
+type Expectation struct {
+	// Method is case insensitive.
+	Method string
+	// URL is matched in the same way as MockTransport.Register.
+	URL string
+	// Headers must all exist in request headers, with the same values.
+	Headers http.Header
+	// Params must all exist in request query string, with the same values.
+	Params url.Values
+	// Body must be equal to request body.
+	Body []byte
+}
+
+// match check whether the call meets the expectation.
+func (e *Expectation) match(call *Call) bool {
+	if e.Method != "" && !strings.EqualFold(e.Method, call.Method) {
+		return false
+	}
+	if e.URL != "" {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return false
+		}
+		m := &matcher{url: u}
+		if !m.match(&http.Request{Method: call.Method, URL: call.URL}) {
+			return false
+		}
+	}
+	for key, values := range e.Headers {
+		if !equalValues(values, call.Headers.Values(key)) {
+			return false
+		}
+	}
+	query := call.URL.Query()
+	for key, values := range e.Params {
+		if !equalValues(values, query[key]) {
+			return false
+		}
+	}
+	if e.Body != nil && !bytes.Equal(e.Body, call.Body) {
+		return false
+	}
+	return true
+}
+
+// equalValues check whether two slice of string are equal.
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Find returns the recorded requests which meet the expectation.
+func (m *MockTransport) Find(e Expectation) []*Call {
+	var calls []*Call
+	for _, call := range m.Calls() {
+		if e.match(call) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// AssertCalled asserts that at least one request meets the expectation.
+func (m *MockTransport) AssertCalled(t testing.TB, e Expectation) bool {
+	t.Helper()
+	if len(m.Find(e)) == 0 {
+		t.Errorf("direwolftest: expected request not received: %s\nreceived:\n%s", e.String(), m.callsString())
+		return false
+	}
+	return true
+}
+
+// AssertNotCalled asserts that no request meets the expectation.
+func (m *MockTransport) AssertNotCalled(t testing.TB, e Expectation) bool {
+	t.Helper()
+	if n := len(m.Find(e)); n > 0 {
+		t.Errorf("direwolftest: unexpected request received %d times: %s", n, e.String())
+		return false
+	}
+	return true
+}
+
+// AssertCallCount asserts that exactly n requests meet the expectation.
+func (m *MockTransport) AssertCallCount(t testing.TB, e Expectation, n int) bool {
+	t.Helper()
+	if count := len(m.Find(e)); count != n {
+		t.Errorf("direwolftest: expected request received %d times, want %d: %s", count, n, e.String())
+		return false
+	}
+	return true
+}
+
+// String returns a readable description of the expectation.
+func (e *Expectation) String() string {
+	var buf strings.Builder
+	method := e.Method
+	if method == "" {
+		method = "*"
+	}
+	buf.WriteString(method + " " + e.URL)
+	if len(e.Params) > 0 {
+		buf.WriteString(" params=" + e.Params.Encode())
+	}
+	for key, values := range e.Headers {
+		buf.WriteString(" " + key + "=" + strings.Join(values, ","))
+	}
+	if e.Body != nil {
+		buf.WriteString(" body=" + string(e.Body))
+	}
+	return buf.String()
+}
+
+// callsString returns a readable list of recorded requests.
+func (m *MockTransport) callsString() string {
+	var buf strings.Builder
+	for _, call := range m.Calls() {
+		buf.WriteString("\t" + call.Method + " " + call.URL.String() + "\n")
+	}
+	return buf.String()
+}
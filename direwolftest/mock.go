@@ -0,0 +1,174 @@
+/*
+Package direwolftest provides a programmable mock http.RoundTripper and some
+assertion helpers, for unit testing code that sends requests with direwolf.
+
+Inject the mock into a Session by SessionOptions.Transport:
+
+	mock := direwolftest.NewMockTransport()
+	mock.Register("GET", "https://example.com/user", direwolftest.NewStringResponder(200, "ok"))
+
+	options := direwolf.DefaultSessionOptions()
+	options.Transport = mock
+	session := direwolf.NewSession(options)
+*/
+package direwolftest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrNoResponder is returned when there is no responder matches the request.
+var ErrNoResponder = errors.New("no responder found")
+
+// Call is a request recorded by MockTransport.
+type Call struct {
+	Method  string
+	URL     *url.URL
+	Headers http.Header
+	Body    []byte
+	Request *http.Request
+}
+
+// matcher is a registered responder and the rule to match requests.
+type matcher struct {
+	method    string
+	url       *url.URL
+	regexp    *regexp.Regexp
+	responder Responder
+}
+
+// match check whether the request matches this matcher.
+// Method is case insensitive and empty method matches any method.
+// If the registered URL has no query, the query of request is ignored.
+func (m *matcher) match(req *http.Request) bool {
+	if m.method != "" && !strings.EqualFold(m.method, req.Method) {
+		return false
+	}
+	if m.regexp != nil {
+		return m.regexp.MatchString(req.URL.String())
+	}
+	if m.url.Scheme != req.URL.Scheme || m.url.Host != req.URL.Host || m.url.Path != req.URL.Path {
+		return false
+	}
+	if m.url.RawQuery == "" {
+		return true
+	}
+	return m.url.Query().Encode() == req.URL.Query().Encode()
+}
+
+// MockTransport is a http.RoundTripper which returns programmed responses
+// instead of sending requests, and records every request it receives.
+// It is safe for concurrent use.
+type MockTransport struct {
+	mu       sync.Mutex
+	matchers []*matcher
+	calls    []*Call
+
+	// NoResponder is called when no registered responder matches the
+	// request. If nil, an error wrapping ErrNoResponder is returned.
+	NoResponder Responder
+}
+
+// NewMockTransport new a MockTransport without any responder.
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+// Register add a responder for the given method and URL.
+// Empty method matches any method. If URL has no query string, the query
+// of requests is ignored when matching, otherwise it must be equal.
+//
+// Responders are matched in the order they are registered.
+func (m *MockTransport) Register(method, URL string, responder Responder) {
+	u, err := url.Parse(URL)
+	if err != nil {
+		panic("direwolftest: invalid URL " + URL)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matchers = append(m.matchers, &matcher{method: method, url: u, responder: responder})
+}
+
+// RegisterRegexp add a responder for the given method and URL pattern.
+// The pattern is matched against the full request URL, include query string.
+func (m *MockTransport) RegisterRegexp(method string, pattern *regexp.Regexp, responder Responder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matchers = append(m.matchers, &matcher{method: method, regexp: pattern, responder: responder})
+}
+
+// RoundTrip implements http.RoundTripper. It records the request and returns
+// the response of first matched responder.
+func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := &Call{
+		Method:  req.Method,
+		URL:     req.URL,
+		Headers: req.Header.Clone(),
+		Request: req,
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Body.Close(); err != nil {
+			return nil, err
+		}
+		call.Body = body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	m.mu.Lock()
+	m.calls = append(m.calls, call)
+	responder := m.NoResponder
+	for _, matcher := range m.matchers {
+		if matcher.match(req) {
+			responder = matcher.responder
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if responder == nil {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoResponder, req.Method, req.URL.String())
+	}
+	return responder(req)
+}
+
+// Calls returns all requests received, in the order they were received.
+func (m *MockTransport) Calls() []*Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls := make([]*Call, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// CallCount returns the total number of requests received.
+func (m *MockTransport) CallCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.calls)
+}
+
+// CallCountOf returns the number of requests received with the given method
+// and URL. URL is matched in the same way as Register.
+func (m *MockTransport) CallCountOf(method, URL string) int {
+	return len(m.Find(Expectation{Method: method, URL: URL}))
+}
+
+// Reset removes all responders and recorded requests.
+func (m *MockTransport) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.matchers = nil
+	m.calls = nil
+}
@@ -0,0 +1,126 @@
+package direwolftest_test
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	dw "github.com/wnanbei/direwolf"
+	"github.com/wnanbei/direwolf/direwolftest"
+)
+
+// fakeTB records failure instead of failing the test.
+type fakeTB struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failed = true
+}
+
+func newMockSession(mock *direwolftest.MockTransport) *dw.Session {
+	options := dw.DefaultSessionOptions()
+	options.Transport = mock
+	return dw.NewSession(options)
+}
+
+func TestMockTransportResponder(t *testing.T) {
+	mock := direwolftest.NewMockTransport()
+	mock.Register("GET", "https://example.com/user", direwolftest.NewStringResponder(200, "user"))
+	mock.RegisterRegexp("", regexp.MustCompile(`/item/\d+$`), direwolftest.NewJsonResponder(201, map[string]int{"id": 1}))
+	session := newMockSession(mock)
+
+	resp, err := session.Get("https://example.com/user", dw.NewParams("id", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || resp.Text() != "user" {
+		t.Fatal("MockTransport string responder failed.")
+	}
+
+	resp, err = session.Post("https://example.com/item/12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 || resp.JsonGet("id").Int() != 1 {
+		t.Fatal("MockTransport regexp responder failed.")
+	}
+	if resp.Headers.Get("Content-Type") != "application/json" {
+		t.Fatal("MockTransport json responder failed.")
+	}
+
+	if _, err := session.Get("https://example.com/none"); !errors.Is(err, direwolftest.ErrNoResponder) {
+		t.Fatal("MockTransport no responder failed: ", err)
+	}
+	if mock.CallCount() != 3 || mock.CallCountOf("GET", "https://example.com/user") != 1 {
+		t.Fatal("MockTransport call count failed.")
+	}
+}
+
+func TestMockTransportError(t *testing.T) {
+	mock := direwolftest.NewMockTransport()
+	mockErr := errors.New("connection refused")
+	mock.Register("GET", "https://example.com/error", direwolftest.NewErrorResponder(mockErr))
+	mock.Register("GET", "https://example.com/slow", direwolftest.NewStringResponder(200, "slow").Delay(3*time.Second))
+	mock.Register("GET", "https://example.com/flaky",
+		direwolftest.NewStringResponder(503, "").Times(1, direwolftest.NewStringResponder(200, "ok")))
+	session := newMockSession(mock)
+
+	if _, err := session.Get("https://example.com/error"); !errors.Is(err, mockErr) {
+		t.Fatal("MockTransport error responder failed: ", err)
+	}
+	if _, err := session.Get("https://example.com/slow", dw.Timeout(1)); !errors.Is(err, dw.ErrTimeout) {
+		t.Fatal("MockTransport delay responder failed: ", err)
+	}
+
+	resp, _ := session.Get("https://example.com/flaky")
+	if resp.StatusCode != 503 {
+		t.Fatal("MockTransport times responder failed.")
+	}
+	resp, _ = session.Get("https://example.com/flaky")
+	if resp.StatusCode != 200 {
+		t.Fatal("MockTransport times responder failed.")
+	}
+}
+
+func TestMockTransportAssert(t *testing.T) {
+	mock := direwolftest.NewMockTransport()
+	mock.Register("POST", "https://example.com/login", direwolftest.NewStringResponder(200, "ok"))
+	session := newMockSession(mock)
+
+	_, err := session.Post(
+		"https://example.com/login",
+		dw.NewParams("next", "/home"),
+		dw.NewHeaders("X-Token", "secret"),
+		dw.NewPostForm("user", "direwolf"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.AssertCalled(t, direwolftest.Expectation{
+		Method:  "POST",
+		URL:     "https://example.com/login",
+		Headers: http.Header{"X-Token": {"secret"}, "Content-Type": {"application/x-www-form-urlencoded"}},
+		Params:  url.Values{"next": {"/home"}},
+		Body:    []byte("user=direwolf"),
+	})
+	mock.AssertCallCount(t, direwolftest.Expectation{Method: "POST"}, 1)
+	mock.AssertNotCalled(t, direwolftest.Expectation{Method: "GET"})
+
+	ft := &fakeTB{TB: t}
+	if mock.AssertCalled(ft, direwolftest.Expectation{Body: []byte("user=other")}) || !ft.failed {
+		t.Fatal("MockTransport.AssertCalled should fail with wrong body.")
+	}
+
+	mock.Reset()
+	if mock.CallCount() != 0 {
+		t.Fatal("MockTransport.Reset failed.")
+	}
+}
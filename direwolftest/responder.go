@@ -0,0 +1,103 @@
+package direwolftest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Responder build the response for a request received by MockTransport.
+type Responder func(req *http.Request) (*http.Response, error)
+
+// NewResponse new a http.Response with status code and body for the request.
+func NewResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// NewBytesResponder returns a Responder which responds the status code and body.
+func NewBytesResponder(status int, body []byte) Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		return NewResponse(req, status, body), nil
+	}
+}
+
+// NewStringResponder returns a Responder which responds the status code and body.
+func NewStringResponder(status int, body string) Responder {
+	return NewBytesResponder(status, []byte(body))
+}
+
+// NewJsonResponder returns a Responder which responds the json encoded v,
+// with Content-Type application/json. It panics if v can not be encoded.
+func NewJsonResponder(status int, v interface{}) Responder {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic("direwolftest: " + err.Error())
+	}
+	return NewBytesResponder(status, body).Header("Content-Type", "application/json")
+}
+
+// NewErrorResponder returns a Responder which always returns the error.
+func NewErrorResponder(err error) Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		return nil, err
+	}
+}
+
+// Header returns a Responder which adds a header to the response.
+func (r Responder) Header(key, value string) Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		resp, err := r(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Header.Add(key, value)
+		return resp, nil
+	}
+}
+
+// Delay returns a Responder which waits for d before responding.
+// If the request context is done before that, the context error is returned,
+// so it can be used to test timeout.
+func (r Responder) Delay(d time.Duration) Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return r(req)
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// Times returns a Responder which responds by r for the first n requests,
+// and by next for the rest. It can be used to test retry.
+func (r Responder) Times(n int, next Responder) Responder {
+	var count int
+	var mu sync.Mutex
+	return func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		count++
+		current := count
+		mu.Unlock()
+		if current <= n {
+			return r(req)
+		}
+		return next(req)
+	}
+}
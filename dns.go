@@ -0,0 +1,153 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ErrHostOverride is returned when the ip of SessionOptions.HostOverrides
+// is invalid.
+var ErrHostOverride = errors.New("invalid host override")
+
+// resolver resolves the host names for dialer. It checks the host overrides
+// first, then the cache, and looks up by the net.Resolver at last.
+type resolver struct {
+	overrides map[string]net.IP
+	resolver  *net.Resolver
+	cache     *dnsCache
+}
+
+// newResolver new a resolver from SessionOptions. It returns nil if none of
+// the dns options is set, then the host names are resolved by net.Dialer.
+func newResolver(options *SessionOptions) (*resolver, error) {
+	if len(options.HostOverrides) == 0 && options.DNSServer == "" &&
+		options.Resolver == nil && options.DNSCacheTTL <= 0 {
+		return nil, nil
+	}
+
+	r := &resolver{
+		overrides: make(map[string]net.IP, len(options.HostOverrides)),
+		resolver:  net.DefaultResolver,
+	}
+	for host, addr := range options.HostOverrides {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, WrapErrf(ErrHostOverride, "%s: %s", host, addr)
+		}
+		r.overrides[host] = ip
+	}
+	if options.Resolver != nil {
+		r.resolver = options.Resolver
+	} else if options.DNSServer != "" {
+		server := options.DNSServer
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: options.DialTimeout}
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	if options.DNSCacheTTL > 0 {
+		r.cache = &dnsCache{ttl: options.DNSCacheTTL, entries: make(map[string]*dnsEntry)}
+	}
+	return r, nil
+}
+
+// lookup returns the ips of host. The network is "tcp", "tcp4" or "tcp6".
+func (r *resolver) lookup(ctx context.Context, network, host, port string) ([]net.IP, error) {
+	if ip, ok := r.overrides[net.JoinHostPort(host, port)]; ok {
+		return []net.IP{ip}, nil
+	}
+	if ip, ok := r.overrides[host]; ok {
+		return []net.IP{ip}, nil
+	}
+
+	key := network + "/" + host
+	if r.cache != nil {
+		if ips, ok := r.cache.get(key); ok {
+			return ips, nil
+		}
+	}
+
+	// The host is not resolved by net.Dialer, so call the trace hooks here.
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	ipNetwork := "ip"
+	if network == "tcp4" {
+		ipNetwork = "ip4"
+	} else if network == "tcp6" {
+		ipNetwork = "ip6"
+	}
+	ips, err := r.resolver.LookupIP(ctx, ipNetwork, host)
+	if trace != nil && trace.DNSDone != nil {
+		addrs := make([]net.IPAddr, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.IPAddr{IP: ip}
+		}
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.cache != nil {
+		r.cache.set(key, ips)
+	}
+	return ips, nil
+}
+
+// dnsCache caches the resolved ips of hosts until the ttl expires. The
+// expired entries are swept once a ttl by set, so the cache only holds the
+// hosts resolved in the last two ttls.
+type dnsCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*dnsEntry
+	nextSweep time.Time
+}
+
+// dnsEntry is the cached ips of a host.
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// get returns the cached ips if it is not expired.
+func (c *dnsCache) get(key string) ([]net.IP, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.ips, true
+}
+
+// set caches the ips of host, and sweeps the expired entries.
+func (c *dnsCache) set(key string, ips []net.IP) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.After(c.nextSweep) {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[key] = &dnsEntry{ips: ips, expires: now.Add(c.ttl)}
+}
@@ -0,0 +1,138 @@
+package direwolf
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestDNSServer starts a dns server which resolves all A queries to
+// 127.0.0.1, and counts the queries.
+func newTestDNSServer(t *testing.T, queries *int32) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+				continue
+			}
+			atomic.AddInt32(queries, 1)
+			msg.Header.Response = true
+			msg.Header.Authoritative = true
+			question := msg.Questions[0]
+			if question.Type == dnsmessage.TypeA {
+				msg.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			}
+			packed, err := msg.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func newHostServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host))
+	}))
+}
+
+func TestHostOverrides(t *testing.T) {
+	ts := newHostServer()
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+
+	options := DefaultSessionOptions()
+	options.HostOverrides = map[string]string{
+		"canary.test":        "127.0.0.1",
+		"other.test:" + port: "127.0.0.1",
+	}
+	session := NewSession(options)
+	for _, host := range []string{"canary.test:" + port, "other.test:" + port} {
+		resp, err := session.Get("http://" + host + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != host {
+			t.Fatal("HostOverrides should keep the Host header: ", resp.Text())
+		}
+		if !resp.Timings.DNSStart.IsZero() {
+			t.Fatal("Overridden host should not be resolved.")
+		}
+	}
+
+	options = DefaultSessionOptions()
+	options.HostOverrides = map[string]string{"canary.test": "not an ip"}
+	if NewSession(options) != nil {
+		t.Fatal("NewSession should fail with invalid HostOverrides.")
+	}
+	if _, err := newResolver(options); !errors.Is(err, ErrHostOverride) {
+		t.Fatal("newResolver should return ErrHostOverride.")
+	}
+}
+
+func TestDNSServerAndCache(t *testing.T) {
+	ts := newHostServer()
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(ts.URL, "http://"))
+
+	var queries int32
+	options := DefaultSessionOptions()
+	options.DNSServer = newTestDNSServer(t, &queries)
+	options.DNSCacheTTL = time.Minute
+	options.ForceIPv4 = true
+	options.DisableDialKeepAlives = true // dial for each request
+	session := NewSession(options)
+
+	for i := 0; i < 3; i++ {
+		resp, err := session.Get("http://crawl.test:" + port + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != "crawl.test:"+port {
+			t.Fatal("DNSServer failed: ", resp.Text())
+		}
+		if i == 0 && resp.Timings.DNSStart.IsZero() {
+			t.Fatal("DNS timings should be recorded.")
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Fatal("resolved ips should be cached, queries: ", n)
+	}
+}
+
+func TestDNSCacheSweep(t *testing.T) {
+	cache := &dnsCache{ttl: 50 * time.Millisecond, entries: make(map[string]*dnsEntry)}
+	for _, host := range []string{"a.test", "b.test", "c.test"} {
+		cache.set("tcp/"+host, []net.IP{net.ParseIP("127.0.0.1")})
+	}
+	time.Sleep(60 * time.Millisecond)
+	cache.set("tcp/d.test", []net.IP{net.ParseIP("127.0.0.1")})
+	if len(cache.entries) != 1 {
+		t.Fatal("expired entries should be swept by set: ", len(cache.entries))
+	}
+	if _, ok := cache.get("tcp/d.test"); !ok {
+		t.Fatal("the entry should be cached.")
+	}
+}
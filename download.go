@@ -11,25 +11,87 @@ import (
 	"time"
 )
 
-// send is low level request method.
-func send(session *Session, req *Request) (*Response, error) {
-	// Set timeout to request context.
-	// Default timeout is 30s.
+// send is low level request method. The request is canceled when ctx is done.
+func send(ctx context.Context, session *Session, req *Request) (response *Response, err error) {
+	event := newRequestEvent(req)
+	session.started(event)
+	spanCtx, span := session.startSpan(ctx, req, event)
+	defer func() {
+		event.finish(response, err)
+		session.emit(ctx, event)
+		if span != nil {
+			endSpan(span, event)
+		}
+	}()
+
+	snapshot := session.snapshot() // the request is not affected by the later changes of session.
+	reqCtx, timeoutCancel := requestContext(spanCtx, snapshot, req)
+	defer timeoutCancel() // cancel the timeout context after request finished.
+	tracer, reqCtx := newRequestTracer(reqCtx)
+	if session.options.preserveHeaderOrder() {
+		reqCtx = withHeaderOrder(reqCtx, headerOrder(snapshot, req))
+	}
+
+	httpReq, err := buildHTTPRequest(reqCtx, session, snapshot, req)
+	if err != nil {
+		return nil, err
+	}
+	event.httpReq = httpReq
+	if span != nil {
+		injectSpan(httpReq.Header, span)
+	}
+
+	if err := prepareRequest(httpReq, session, req); err != nil {
+		return nil, err
+	}
+
+	resp, err := session.clientFor(req).Do(throttleRequest(httpReq, session, req)) // do request
+	if err != nil {
+		if strings.Contains(err.Error(), "context deadline exceeded") { // check timeout error
+			return nil, WrapErr(ErrTimeout, err.Error())
+		}
+		return nil, WrapErr(err, "Request Error")
+	}
+	throttleResponse(reqCtx, resp, session, req)
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	response, err = buildResponse(req, resp, session.options.MaxDecompressedSize)
+	if err != nil {
+		return nil, WrapErr(err, "build Response Error")
+	}
+	response.Timings, response.ConnInfo = tracer.finish()
+	return response, nil
+}
+
+// requestContext derive a context from parent for the request, which carries
+// the timeout, proxy and redirectNum of request.
+func requestContext(parent context.Context, snapshot *sessionSnapshot, req *Request) (context.Context, context.CancelFunc) {
+	ctx, timeoutCancel := context.WithTimeout(parent, requestTimeout(snapshot, req))
+	return withRequestValues(ctx, snapshot, req), timeoutCancel
+}
+
+// requestTimeout returns the timeout of request, or the timeout of session.
+// Default timeout is 30s.
+func requestTimeout(snapshot *sessionSnapshot, req *Request) time.Duration {
 	timeout := time.Second * 30
 	if req.Timeout > 0 {
 		timeout = time.Second * time.Duration(req.Timeout)
-	} else if session.Timeout > 0 {
-		timeout = time.Second * time.Duration(session.Timeout)
+	} else if snapshot.timeout > 0 {
+		timeout = time.Second * time.Duration(snapshot.timeout)
 	}
-	ctx, timeoutCancel := context.WithTimeout(context.Background(), timeout)
+	return timeout
+}
 
+// withRequestValues set the proxy and redirectNum of request to context.
+func withRequestValues(ctx context.Context, snapshot *sessionSnapshot, req *Request) context.Context {
 	// set proxy to request context.
-	if req.Proxy != nil {
-		ctx = context.WithValue(ctx, "http", req.Proxy.HTTP)
-		ctx = context.WithValue(ctx, "https", req.Proxy.HTTPS)
-	} else if session.Proxy != nil {
-		ctx = context.WithValue(ctx, "http", session.Proxy.HTTP)
-		ctx = context.WithValue(ctx, "https", session.Proxy.HTTPS)
+	if proxy := requestProxy(snapshot, req); proxy != nil {
+		ctx = context.WithValue(ctx, "http", proxy.HTTP)
+		ctx = context.WithValue(ctx, "https", proxy.HTTPS)
 	}
 
 	// set RedirectNum to request context.
@@ -41,31 +103,126 @@ func send(session *Session, req *Request) (*Response, error) {
 	} else {
 		ctx = context.WithValue(ctx, "redirectNum", 0)
 	}
+	return ctx
+}
+
+// openStream sends the request and returns the http.Response whose body is
+// not read, so it can be consumed as a stream. The timeout of request only
+// limits the time to receive the response headers. The returned cancel
+// function must be called after the body is closed.
+func openStream(ctx context.Context, session *Session, req *Request) (*http.Response, context.CancelFunc, error) {
+	snapshot := session.snapshot()
+	streamCtx, cancel := context.WithCancel(withRequestValues(ctx, snapshot, req))
+	if session.options.preserveHeaderOrder() {
+		streamCtx = withHeaderOrder(streamCtx, headerOrder(snapshot, req))
+	}
+	httpReq, err := buildHTTPRequest(streamCtx, session, snapshot, req)
+	if err == nil {
+		err = signRequest(httpReq, session, req)
+	}
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	timer := time.AfterFunc(requestTimeout(snapshot, req), cancel)
+	resp, err := session.clientFor(req).Do(throttleRequest(httpReq, session, req))
+	if !timer.Stop() {
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		cancel()
+		return nil, nil, WrapErr(ErrTimeout, "waiting for response headers")
+	}
+	if err != nil {
+		cancel()
+		return nil, nil, WrapErr(err, "Request Error")
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols { // keep the connection of upgrade writable
+		throttleResponse(streamCtx, resp, session, req)
+	}
+	return resp, cancel, nil
+}
+
+// requestProxy returns the proxy of request, or the proxy of session if
+// request has no proxy.
+func requestProxy(snapshot *sessionSnapshot, req *Request) *Proxy {
+	if req.Proxy != nil {
+		return req.Proxy
+	}
+	return snapshot.proxy
+}
+
+// prepareRequest sets the default headers and signs httpReq, after which the
+// headers are what is sent, except the cookies of session. Session can be nil.
+func prepareRequest(httpReq *http.Request, session *Session, req *Request) error {
+	// Advertise all the encodings direwolf can decode, if user does not specify.
+	if httpReq.Header.Get("Accept-Encoding") == "" {
+		httpReq.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	return signRequest(httpReq, session, req)
+}
+
+// buildHTTPRequest make a http.Request with context from Request, merge the
+// headers of session snapshot and set the body. Session can be nil.
+func buildHTTPRequest(ctx context.Context, session *Session, snapshot *sessionSnapshot, req *Request) (*http.Request, error) {
+	// The unix socket is dialed by the dialer of Session.
+	if req.UnixSocket != "" {
+		ctx = context.WithValue(ctx, unixSocketKey{}, req.UnixSocket)
+	}
 
 	// Make new http.Request with context
 	httpReq, err := http.NewRequestWithContext(ctx, req.Method, req.URL, nil)
 	if err != nil {
-		timeoutCancel()
 		return nil, WrapErr(err, "build Request error, please check request url or request method")
 	}
+	if req.UnixSocket != "" { // keep the Host header, connect by the socket host
+		httpReq.Host = httpReq.URL.Host
+		httpReq.URL.Host = unixSocketHost(req.UnixSocket)
+	}
 
 	// Handle the Headers.
-	httpReq.Header = mergeHeaders(req.Headers, session.Headers)
+	httpReq.Header = mergeHeaders(req.Headers, snapshot.headers)
+	if session != nil {
+		session.rotateUserAgent(req, httpReq.Header)
+	}
 
 	// Handle the DataForm, Body or JsonBody.
 	// Set right Content-Type.
+	var body []byte
 	if req.PostForm != nil {
 		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		data := req.PostForm.URLEncode()
-		httpReq.Body = ioutil.NopCloser(strings.NewReader(data))
+		body = []byte(req.PostForm.URLEncode())
 	} else if req.Body != nil {
-		httpReq.Body = ioutil.NopCloser(bytes.NewReader(req.Body))
+		body = req.Body
 	} else if req.JsonBody != nil {
 		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Body = ioutil.NopCloser(bytes.NewReader(req.JsonBody))
+		body = req.JsonBody
 	} else if req.MultipartForm != nil {
+		if req.MultipartForm.consumed() { // fail before a truncated body is sent
+			return nil, WrapErr(errPartConsumed, "MultipartForm can not be sent again")
+		}
 		httpReq.Header.Set("Content-Type", req.MultipartForm.ContentType())
-		httpReq.Body = ioutil.NopCloser(req.MultipartForm.Reader())
+		if req.CompressBody != "" { // the form is buffered to be compressed
+			var buf bytes.Buffer
+			if err := req.MultipartForm.writeTo(&buf); err != nil {
+				return nil, WrapErr(err, "read MultipartForm failed")
+			}
+			body = buf.Bytes()
+		} else {
+			setFormBody(httpReq, req.MultipartForm)
+		}
+	}
+	if body != nil {
+		if req.CompressBody != "" {
+			compressed, err := encodeContent(req.CompressBody, body)
+			if err != nil {
+				return nil, err
+			}
+			httpReq.Header.Set("Content-Encoding", req.CompressBody)
+			body = compressed
+		}
+		setBody(httpReq, body)
 	}
 
 	// Handle Cookies
@@ -74,66 +231,99 @@ func send(session *Session, req *Request) (*Response, error) {
 			httpReq.AddCookie(cookie)
 		}
 	}
+	return httpReq, nil
+}
 
-	resp, err := session.client.Do(httpReq) // do request
-	if err != nil {
-		if strings.Contains(err.Error(), "context deadline exceeded") { // check timeout error
-			timeoutCancel()
-			return nil, WrapErr(ErrTimeout, err.Error())
-		}
-		timeoutCancel()
-		return nil, WrapErr(err, "Request Error")
+// setBody set the body of http.Request, with right ContentLength and GetBody,
+// so that the body can be sent again when redirect.
+func setBody(httpReq *http.Request, body []byte) {
+	if len(body) == 0 { // ContentLength 0 with non-nil Body is treated as unknown
+		httpReq.Body = http.NoBody
+		httpReq.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			panic(err)
-		}
-	}()
-
-	response, err := buildResponse(req, resp)
-	if err != nil {
-		timeoutCancel()
-		return nil, WrapErr(err, "build Response Error")
+	httpReq.ContentLength = int64(len(body))
+	httpReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	httpReq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
 	}
+}
 
-	timeoutCancel() // cancel the timeout context after request succeed.
-	return response, nil
+// setFormBody set the streaming body of MultipartForm. The form is sent again
+// when redirect only if it has no part of io.Reader.
+func setFormBody(httpReq *http.Request, form *MultipartForm) {
+	httpReq.ContentLength = form.ContentLength()
+	httpReq.Body = form.body()
+	if form.rereadable() {
+		httpReq.GetBody = func() (io.ReadCloser, error) {
+			return form.body(), nil
+		}
+	}
 }
 
 // buildResponse build response with http.Response after do request.
-func buildResponse(httpReq *Request, httpResp *http.Response) (*Response, error) {
+// The content is decompressed according to Content-Encoding header, up to
+// maxDecompressedSize bytes, see SessionOptions.MaxDecompressedSize.
+func buildResponse(httpReq *Request, httpResp *http.Response, maxDecompressedSize int64) (*Response, error) {
 	content, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
 		if !errors.Is(err, io.ErrUnexpectedEOF) { // Ignore Unexpected EOF error
 			return nil, WrapErr(err, "read Response.Body failed")
 		}
 	}
-	return &Response{
-		URL:           httpReq.URL,
-		StatusCode:    httpResp.StatusCode,
-		Proto:         httpResp.Proto,
-		Headers:       httpResp.Header,
-		Cookies:       httpResp.Cookies(),
-		Request:       httpReq,
-		ContentLength: httpResp.ContentLength,
-		Content:       content,
-		encoding:      "UTF-8",
-	}, nil
+	response := &Response{
+		URL:              httpReq.URL,
+		StatusCode:       httpResp.StatusCode,
+		Proto:            httpResp.Proto,
+		Headers:          httpResp.Header,
+		Cookies:          httpResp.Cookies(),
+		Request:          httpReq,
+		ContentLength:    httpResp.ContentLength,
+		Content:          content,
+		ContentEncoding:  httpResp.Header.Get("Content-Encoding"),
+		CompressedSize:   int64(len(content)),
+		DecompressedSize: int64(len(content)),
+		encoding:         "UTF-8",
+	}
+
+	if response.ContentEncoding != "" && len(content) > 0 {
+		decoded, err := decodeContentEncoding(response.ContentEncoding, content, maxDecompressedSize)
+		if err != nil {
+			if !errors.Is(err, ErrContentEncoding) { // Keep the content if encoding is unknown
+				return nil, WrapErr(err, "decompress Response.Body failed")
+			}
+		} else {
+			// The same as http.Transport does when decompress gzip content.
+			response.Headers.Del("Content-Encoding")
+			response.Headers.Del("Content-Length")
+			response.ContentLength = -1
+			response.Content = decoded
+			response.DecompressedSize = int64(len(decoded))
+		}
+	}
+	return response, nil
 }
 
-// mergeHeaders merge Request headers and Session Headers.
-// Request has higher priority.
+// mergeHeaders merge the headers of request h1 into the headers of session h2.
+// A key in h1 replaces all the values of the key in h2, and all its values are
+// kept. A key with empty values in h1 deletes the key of h2.
 func mergeHeaders(h1, h2 http.Header) http.Header {
 	h := http.Header{}
 	for key, values := range h2 {
 		for _, value := range values {
-			h.Set(key, value)
+			h.Add(key, value)
 		}
 	}
 	for key, values := range h1 {
-		for _, value := range values {
-			h.Set(key, value)
+		key = http.CanonicalHeaderKey(key)
+		if len(values) == 0 {
+			h.Del(key)
+			if key == "User-Agent" { // or the default User-Agent of Go is sent
+				h[key] = []string{""}
+			}
+			continue
 		}
+		h[key] = append([]string(nil), values...)
 	}
 	return h
 }
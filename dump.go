@@ -0,0 +1,347 @@
+package direwolf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DumpOptions is the options of Request.ToCurl, Request.Dump and Response.Dump.
+type DumpOptions struct {
+	// Session, if non-nil, merges its headers, cookies, proxy and timeout
+	// into the dumped request, just like Session.Send does.
+	Session *Session
+
+	// MaskSecrets replaces the values of Authorization, Cookie, Set-Cookie
+	// and other sensitive headers, and the password of proxy with "***".
+	MaskSecrets bool
+
+	// MaxBodySize limits the size of dumped response body, the rest is
+	// truncated. Zero means the default 4096 bytes, negative means no limit.
+	MaxBodySize int
+}
+
+// maskedValue is the value to replace secrets.
+const maskedValue = "***"
+
+// secretHeaders is the headers which carry secrets.
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"X-Auth-Token":        true,
+}
+
+// dumpOptions returns the first options or a default one.
+func dumpOptions(options []*DumpOptions) *DumpOptions {
+	if len(options) > 0 && options[0] != nil {
+		return options[0]
+	}
+	return &DumpOptions{}
+}
+
+// ToCurl returns a curl command line equivalent to the request. Params,
+// merged session headers, cookies, body, multipart form, proxy, timeout and
+// redirect settings are all covered. It can be parsed back by ParseCurl.
+func (req *Request) ToCurl(options ...*DumpOptions) (string, error) {
+	opts := dumpOptions(options)
+	httpReq, snapshot, err := dumpHTTPRequest(req, opts)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"curl"}
+	switch req.Method {
+	case "GET":
+	case "HEAD":
+		args = append(args, "-I")
+	default:
+		args = append(args, "-X", req.Method)
+	}
+	args = append(args, shellQuote(maskURL(opts, httpReq.URL.String())))
+
+	for _, key := range sortedKeys(httpReq.Header) {
+		if key == "Cookie" || (key == "Content-Type" && req.MultipartForm != nil) {
+			continue // curl set Content-Type with boundary by itself
+		}
+		for _, value := range httpReq.Header[key] {
+			args = append(args, "-H", shellQuote(key+": "+maskHeader(opts, key, value)))
+		}
+	}
+	if cookie := httpReq.Header.Get("Cookie"); cookie != "" {
+		args = append(args, "-b", shellQuote(maskHeader(opts, "Cookie", cookie)))
+	}
+
+	if req.MultipartForm != nil {
+		for _, part := range req.MultipartForm.parts {
+			if part.filePath == "" && part.reader == nil {
+				args = append(args, "-F", shellQuote(part.key+"="+part.value))
+				continue
+			}
+			source := part.filePath
+			if part.reader != nil { // the content of io.Reader is read from stdin
+				source = "-"
+			}
+			file := part.key + "=@" + source + ";type=" + part.contentType
+			if part.fileName != "" {
+				file += ";filename=" + part.fileName
+			}
+			for _, key := range sortedKeys(part.header) {
+				for _, value := range part.header[key] {
+					file += `;headers="` + key + ": " + value + `"`
+				}
+			}
+			args = append(args, "-F", shellQuote(file))
+		}
+	} else if httpReq.GetBody != nil {
+		body, err := readBody(httpReq)
+		if err != nil {
+			return "", err
+		}
+		if len(body) > 0 {
+			args = append(args, "--data-raw", shellQuote(string(body)))
+		}
+	}
+
+	if proxy := requestProxy(snapshot, req); proxy != nil {
+		proxyURL := proxy.HTTP
+		if httpReq.URL.Scheme == "https" {
+			proxyURL = proxy.HTTPS
+		}
+		if proxyURL != "" {
+			args = append(args, "-x", shellQuote(maskURL(opts, proxyURL)))
+		}
+	}
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = snapshot.timeout
+	}
+	if timeout > 0 {
+		args = append(args, "--max-time", strconv.Itoa(timeout))
+	}
+	if req.RedirectNum >= 0 {
+		redirectNum := req.RedirectNum
+		if redirectNum == 0 { // the default of direwolf, not of curl
+			redirectNum = 10
+		}
+		args = append(args, "-L", "--max-redirs", strconv.Itoa(redirectNum))
+	}
+	if req.InsecureSkipVerify {
+		args = append(args, "-k")
+	}
+	if httpReq.Header.Get("Accept-Encoding") != "" { // direwolf always decodes the response
+		args = append(args, "--compressed")
+	}
+	return strings.Join(args, " "), nil
+}
+
+// Dump returns the request in HTTP/1.1 wire format, include the request
+// line, merged headers, cookies, signature and body. The content of files and
+// readers in MultipartForm is replaced by placeholders, so they are not read
+// and the request can still be sent.
+func (req *Request) Dump(options ...*DumpOptions) (string, error) {
+	opts := dumpOptions(options)
+	httpReq, _, err := dumpHTTPRequest(req, opts)
+	if err != nil {
+		return "", err
+	}
+	if user := httpReq.URL.User; user != nil && httpReq.Header.Get("Authorization") == "" {
+		password, _ := user.Password() // http.Client sends the user of URL by basic auth
+		httpReq.SetBasicAuth(user.Username(), password)
+	}
+	switch {
+	case httpReq.ContentLength > 0:
+		httpReq.Header.Set("Content-Length", strconv.FormatInt(httpReq.ContentLength, 10))
+	case httpReq.ContentLength < 0:
+		httpReq.Header.Set("Transfer-Encoding", "chunked")
+	}
+
+	var buf bytes.Buffer
+	host := httpReq.Host
+	if host == "" {
+		host = httpReq.URL.Host
+	}
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", httpReq.Method, maskURL(opts, httpReq.URL.RequestURI()))
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	for _, key := range sortedKeys(httpReq.Header) {
+		for _, value := range httpReq.Header[key] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, maskHeader(opts, key, value))
+		}
+	}
+	buf.WriteString("\r\n")
+
+	if req.MultipartForm != nil {
+		if err := req.MultipartForm.writePreview(&buf); err != nil {
+			return "", WrapErr(err, "dump request failed")
+		}
+	} else if httpReq.GetBody != nil {
+		body, err := readBody(httpReq)
+		if err != nil {
+			return "", err
+		}
+		buf.Write(body)
+	}
+	return buf.String(), nil
+}
+
+// Dump returns the response in HTTP/1.1 wire format, include the status
+// line, headers and body. Body is truncated to DumpOptions.MaxBodySize.
+func (resp *Response) Dump(options ...*DumpOptions) string {
+	opts := dumpOptions(options)
+
+	var buf strings.Builder
+	proto := resp.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(&buf, "%s %d %s\r\n", proto, resp.StatusCode, http.StatusText(resp.StatusCode))
+	for _, key := range sortedKeys(resp.Headers) {
+		for _, value := range resp.Headers[key] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, maskHeader(opts, key, value))
+		}
+	}
+	buf.WriteString("\r\n")
+
+	maxBodySize := opts.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = 4096
+	}
+	if maxBodySize > 0 && len(resp.Content) > maxBodySize {
+		buf.Write(resp.Content[:maxBodySize])
+		fmt.Fprintf(&buf, "\n... (%d bytes truncated)", len(resp.Content)-maxBodySize)
+	} else {
+		buf.Write(resp.Content)
+	}
+	return buf.String()
+}
+
+// dumpHTTPRequest builds the http.Request as Session.Send does, with the
+// default headers, signature and cookies of session. The parts of MultipartForm
+// are never read, so a compressed form is dumped without compression.
+func dumpHTTPRequest(req *Request, opts *DumpOptions) (*http.Request, *sessionSnapshot, error) {
+	snapshot := opts.Session.snapshot()
+	build := req
+	if req.MultipartForm != nil && req.CompressBody != "" { // compressing buffers the whole form
+		copied := *req
+		copied.CompressBody = ""
+		build = &copied
+	}
+	httpReq, err := buildHTTPRequest(context.Background(), opts.Session, snapshot, build)
+	if err != nil {
+		return nil, nil, err
+	}
+	if build != req {
+		httpReq.Header.Set("Content-Encoding", req.CompressBody)
+		httpReq.ContentLength = -1
+	}
+	if err := prepareRequest(httpReq, opts.Session, req); err != nil {
+		return nil, nil, err
+	}
+	addSessionCookies(httpReq, opts.Session)
+	return httpReq, snapshot, nil
+}
+
+// addSessionCookies add the cookies in session cookie jar to request, just like
+// http.Client does when sending request.
+func addSessionCookies(httpReq *http.Request, session *Session) {
+	if session == nil || session.client.Jar == nil {
+		return
+	}
+	for _, cookie := range session.client.Jar.Cookies(httpReq.URL) {
+		httpReq.AddCookie(cookie)
+	}
+}
+
+// readBody returns the body of http.Request without consuming it.
+func readBody(httpReq *http.Request) ([]byte, error) {
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return nil, WrapErr(err, "read request body failed")
+	}
+	defer body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, WrapErr(err, "read request body failed")
+	}
+	return buf.Bytes(), nil
+}
+
+// maskHeader returns masked value if the header carries secrets and MaskSecrets is set.
+func maskHeader(opts *DumpOptions, key, value string) string {
+	if opts.MaskSecrets && secretHeaders[http.CanonicalHeaderKey(key)] {
+		return maskedValue
+	}
+	return value
+}
+
+// maskURL returns the URL with masked password if MaskSecrets is set.
+func maskURL(opts *DumpOptions, rawURL string) string {
+	if !opts.MaskSecrets {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), maskedValue)
+	}
+	return u.String()
+}
+
+// sortedKeys returns the keys of header in sorted order.
+func sortedKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote quotes s for POSIX shell. Strings with control characters or
+// invalid UTF-8 are quoted by $'...' with escapes.
+func shellQuote(s string) string {
+	printable := utf8.ValidString(s)
+	for _, r := range s {
+		if !printable || (unicode.IsControl(r) && r != '\n') {
+			printable = false
+			break
+		}
+	}
+	if printable {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+
+	var buf strings.Builder
+	buf.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c == '\n':
+			buf.WriteString(`\n`)
+		case c == '\r':
+			buf.WriteString(`\r`)
+		case c == '\t':
+			buf.WriteString(`\t`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&buf, `\x%02x`, c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('\'')
+	return buf.String()
+}
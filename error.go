@@ -1,8 +1,12 @@
 package direwolf
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"net"
 	"runtime"
 	"strconv"
 	"time"
@@ -73,3 +77,49 @@ func WrapErrf(err error, format string, args ...interface{}) error {
 		time:     time.Now().Format("2006-01-02 15:04:05"),
 	}
 }
+
+// The kinds of error returned by ErrorKind.
+const (
+	ErrorKindTimeout  = "timeout"
+	ErrorKindCanceled = "canceled"
+	ErrorKindDNS      = "dns"
+	ErrorKindConnect  = "connect"
+	ErrorKindTLS      = "tls"
+	ErrorKindRedirect = "redirect"
+	ErrorKindOther    = "other"
+)
+
+// ErrorKind classifies the error returned by sending request, such as
+// "timeout", "dns" and "tls". It returns empty string if err is nil.
+func ErrorKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	var redirectErr *RedirectError
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var recordErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	case errors.As(err, &redirectErr):
+		return ErrorKindRedirect
+	case errors.As(err, &dnsErr):
+		return ErrorKindDNS
+	case errors.As(err, &recordErr), errors.As(err, &certErr), errors.As(err, &authorityErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return ErrorKindTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorKindTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ErrorKindConnect
+	}
+	return ErrorKindOther
+}
@@ -0,0 +1,492 @@
+package direwolf
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/proxy"
+)
+
+// ErrTLSFingerprint is returned when the TLS fingerprint of profile is unknown.
+var ErrTLSFingerprint = errors.New("unknown TLS fingerprint")
+
+// ErrProxyTunnel is returned when the tunnel through proxy can not be set up.
+var ErrProxyTunnel = errors.New("proxy tunnel failed")
+
+// TLSFingerprint is the ClientHello of a browser, which is sent in the TLS
+// handshake of https requests instead of the one of Go. See
+// BrowserProfile.TLSFingerprint.
+type TLSFingerprint string
+
+// The supported TLS fingerprints.
+const (
+	FingerprintChrome  TLSFingerprint = "chrome"
+	FingerprintFirefox TLSFingerprint = "firefox"
+	FingerprintSafari  TLSFingerprint = "safari"
+	FingerprintIOS     TLSFingerprint = "ios"
+)
+
+// clientHelloID returns the uTLS ClientHello of fingerprint.
+func (fingerprint TLSFingerprint) clientHelloID() (utls.ClientHelloID, error) {
+	switch fingerprint {
+	case FingerprintChrome:
+		return utls.HelloChrome_Auto, nil
+	case FingerprintFirefox:
+		return utls.HelloFirefox_Auto, nil
+	case FingerprintSafari:
+		return utls.HelloSafari_Auto, nil
+	case FingerprintIOS:
+		return utls.HelloIOS_Auto, nil
+	}
+	return utls.ClientHelloID{}, WrapErrf(ErrTLSFingerprint, "fingerprint %q", string(fingerprint))
+}
+
+// utlsHandshake runs the TLS handshake over conn with the ClientHello of
+// fingerprint. ALPN offers HTTP/2 and HTTP/1.1 as the browser does, unless
+// allowHTTP2 is false.
+func utlsHandshake(ctx context.Context, conn net.Conn, config *tls.Config, fingerprint TLSFingerprint, allowHTTP2 bool) (net.Conn, error) {
+	helloID, err := fingerprint.clientHelloID()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := utls.UTLSIdToSpec(helloID)
+	if err != nil {
+		return nil, WrapErr(err, "build ClientHello failed")
+	}
+	if !allowHTTP2 {
+		// Offer HTTP/1.1 only, and drop ALPS which is only for HTTP/2. Then
+		// the ClientHello is no longer the same as the browser.
+		extensions := spec.Extensions[:0]
+		for _, ext := range spec.Extensions {
+			switch ext := ext.(type) {
+			case *utls.ALPNExtension:
+				ext.AlpnProtocols = []string{"http/1.1"}
+			case *utls.ApplicationSettingsExtension:
+				continue
+			}
+			extensions = append(extensions, ext)
+		}
+		spec.Extensions = extensions
+	}
+
+	uconn := utls.UClient(conn, &utls.Config{
+		ServerName:         config.ServerName,
+		RootCAs:            config.RootCAs,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		KeyLogWriter:       config.KeyLogWriter,
+	}, utls.HelloCustom)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		return nil, WrapErr(err, "apply ClientHello failed")
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err = uconn.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		state := uconn.ConnectionState()
+		trace.TLSHandshakeDone(tls.ConnectionState{
+			Version:            state.Version,
+			HandshakeComplete:  state.HandshakeComplete,
+			DidResume:          state.DidResume,
+			CipherSuite:        state.CipherSuite,
+			NegotiatedProtocol: state.NegotiatedProtocol,
+			ServerName:         state.ServerName,
+			PeerCertificates:   state.PeerCertificates,
+			VerifiedChains:     state.VerifiedChains,
+		}, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return uconn, nil
+}
+
+// negotiatedProtocol returns the protocol selected by ALPN of the connection
+// handshaked by tlsHandshake, HTTP/1.1 if the server selects none.
+func negotiatedProtocol(conn net.Conn) string {
+	var proto string
+	switch conn := conn.(type) {
+	case *tls.Conn:
+		proto = conn.ConnectionState().NegotiatedProtocol
+	case *utls.UConn:
+		proto = conn.ConnectionState().NegotiatedProtocol
+	}
+	if proto == "" {
+		return "http/1.1"
+	}
+	return proto
+}
+
+// tunnelTransport sends the requests of Session when the headers are sent in
+// order. http requests are sent by direct, which writes the headers by
+// orderedConn. https requests are sent by alpnTransport, which handshakes TLS
+// by direwolf, and dials the tunnel through proxy by direwolf too, so the TLS
+// fingerprint is kept through proxy. Only the alpnTransports of the recently
+// used proxies are kept, so rotating proxies does not pile up connection
+// pools.
+type tunnelTransport struct {
+	direct  *http.Transport
+	https   *alpnTransport // https requests not through proxy
+	dialer  *dialer
+	options *SessionOptions
+
+	mu      sync.Mutex
+	tunnels *lruCache[string, *alpnTransport] // by the URL of proxy
+}
+
+// maxTunnelTransports is the number of proxies whose Transports are kept.
+const maxTunnelTransports = 64
+
+// newTunnelTransport new a tunnelTransport, which builds the Transports of
+// https requests from direct.
+func newTunnelTransport(direct *http.Transport, dialer *dialer, options *SessionOptions) *tunnelTransport {
+	return &tunnelTransport{
+		direct:  direct,
+		https:   newALPNTransport(direct, dialer.DialContext, options),
+		dialer:  dialer,
+		options: options,
+		tunnels: newLRUCache(maxTunnelTransports, func(_ string, trans *alpnTransport) {
+			trans.CloseIdleConnections()
+		}),
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *tunnelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.direct.RoundTrip(req)
+	}
+	if t.direct.Proxy == nil {
+		return t.https.RoundTrip(req)
+	}
+	proxyURL, err := t.direct.Proxy(req)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return t.https.RoundTrip(req)
+	}
+	return t.tunnel(proxyURL).RoundTrip(req)
+}
+
+// tunnel returns the Transport which sends requests through proxyURL.
+func (t *tunnelTransport) tunnel(proxyURL *url.URL) *alpnTransport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := proxyURL.String()
+	if trans, ok := t.tunnels.get(key); ok {
+		return trans
+	}
+	trans := newALPNTransport(t.direct, func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialTunnel(ctx, t.dialer, proxyURL, addr)
+	}, t.options)
+	t.tunnels.add(key, trans)
+	return trans
+}
+
+// CloseIdleConnections closes the idle connections of all Transports.
+func (t *tunnelTransport) CloseIdleConnections() {
+	t.direct.CloseIdleConnections()
+	t.https.CloseIdleConnections()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tunnels.each(func(_ string, trans *alpnTransport) {
+		trans.CloseIdleConnections()
+	})
+}
+
+// errALPNChanged is returned when the server selects another protocol than
+// the one it selected before.
+var errALPNChanged = errors.New("server changed the ALPN protocol")
+
+// alpnTransport sends https requests over the TLS connections handshaked by
+// direwolf, with the TLS fingerprint of Profile if it is set. ALPN offers
+// HTTP/2 and HTTP/1.1, or HTTP/1.1 only if SessionOptions.DisableHTTP2.
+// http.Transport only speaks HTTP/2 over the *tls.Conn handshaked by itself,
+// so the first request to a host handshakes a connection to learn the
+// protocol selected by the server, then the requests to the host are sent by
+// the HTTP/2 or the HTTP/1.1 Transport. Headers are only written in order over
+// HTTP/1.1.
+type alpnTransport struct {
+	h1          *http.Transport
+	h2          *http2.Transport // nil if HTTP/2 is disabled
+	dial        func(ctx context.Context, network, addr string) (net.Conn, error)
+	fingerprint TLSFingerprint
+
+	mu       sync.Mutex
+	protos   *lruCache[string, string] // the protocol selected by the server of addr
+	learning map[string]chan struct{}  // closed when the protocol of addr is learned
+	pending  map[string]net.Conn       // the connection which learned the protocol of addr
+}
+
+// maxALPNHosts is the number of hosts whose protocols are kept.
+const maxALPNHosts = 1024
+
+// newALPNTransport new an alpnTransport, which builds the HTTP/1.1 Transport
+// from base, and dials the TCP connections by dial.
+func newALPNTransport(base *http.Transport, dial func(ctx context.Context, network, addr string) (net.Conn, error), options *SessionOptions) *alpnTransport {
+	t := &alpnTransport{
+		h1:          base.Clone(),
+		dial:        dial,
+		fingerprint: options.tlsFingerprint(),
+		protos:      newLRUCache[string, string](maxALPNHosts, nil),
+		learning:    make(map[string]chan struct{}),
+		pending:     make(map[string]net.Conn),
+	}
+	t.h1.Proxy = nil
+	// A non-nil empty TLSNextProto disables HTTP/2, which is sent by h2.
+	t.h1.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	t.h1.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := t.dialTLS(ctx, addr, "http/1.1")
+		if err != nil {
+			return nil, err
+		}
+		return &orderedConn{Conn: conn}, nil
+	}
+	if !options.DisableHTTP2 {
+		t.h2 = &http2.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.dialTLS(ctx, addr, http2.NextProtoTLS)
+			},
+			DisableCompression: true, // direwolf decompress the content by itself
+			IdleConnTimeout:    base.IdleConnTimeout,
+		}
+		applyHTTP2Options(t.h2, options)
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *alpnTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.h2 == nil {
+		return t.h1.RoundTrip(req)
+	}
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	proto, learned, err := t.protocol(req.Context(), addr)
+	if err != nil {
+		return nil, err
+	}
+	if learned { // close the connection if the Transport did not dial it
+		defer t.dropPending(addr)
+	}
+	if proto == http2.NextProtoTLS {
+		return t.h2.RoundTrip(req)
+	}
+	return t.h1.RoundTrip(req)
+}
+
+// protocol returns the protocol selected by the server of addr. The first
+// request to addr handshakes a connection to learn it, which is kept for the
+// next dial, then learned is true. The other requests wait for it.
+func (t *alpnTransport) protocol(ctx context.Context, addr string) (proto string, learned bool, err error) {
+	t.mu.Lock()
+	for {
+		if proto, ok := t.protos.get(addr); ok {
+			t.mu.Unlock()
+			return proto, false, nil
+		}
+		wait, ok := t.learning[addr]
+		if !ok {
+			break
+		}
+		t.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+		t.mu.Lock()
+	}
+	done := make(chan struct{})
+	t.learning[addr] = done
+	t.mu.Unlock()
+
+	conn, err := t.handshake(ctx, addr)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.learning, addr)
+	close(done)
+	if err != nil {
+		return "", false, err
+	}
+	proto = negotiatedProtocol(conn)
+	t.protos.add(addr, proto)
+	if old, ok := t.pending[addr]; ok {
+		_ = old.Close()
+	}
+	t.pending[addr] = conn
+	return proto, true, nil
+}
+
+// dialTLS returns the connection which learned the protocol of addr if there
+// is one, or handshakes a new connection, whose server must select proto.
+func (t *alpnTransport) dialTLS(ctx context.Context, addr, proto string) (net.Conn, error) {
+	t.mu.Lock()
+	conn, ok := t.pending[addr]
+	if ok && negotiatedProtocol(conn) == proto {
+		delete(t.pending, addr)
+		t.mu.Unlock()
+		return conn, nil
+	}
+	t.mu.Unlock()
+
+	conn, err := t.handshake(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if selected := negotiatedProtocol(conn); selected != proto {
+		// Learn the protocol again by the next request.
+		t.mu.Lock()
+		t.protos.remove(addr)
+		t.mu.Unlock()
+		_ = conn.Close()
+		return nil, WrapErrf(errALPNChanged, "%s selected %s instead of %s", addr, selected, proto)
+	}
+	return conn, nil
+}
+
+// dropPending closes the connection which learned the protocol of addr, if
+// it is not used by the Transports.
+func (t *alpnTransport) dropPending(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if conn, ok := t.pending[addr]; ok {
+		_ = conn.Close()
+		delete(t.pending, addr)
+	}
+}
+
+// handshake dials a connection to addr and runs the TLS handshake.
+func (t *alpnTransport) handshake(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := t.dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn, err := tlsHandshake(ctx, conn, addr, t.h1.TLSClientConfig, t.fingerprint, t.h2 != nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// CloseIdleConnections closes the idle connections of both Transports.
+func (t *alpnTransport) CloseIdleConnections() {
+	t.h1.CloseIdleConnections()
+	if t.h2 != nil {
+		t.h2.CloseIdleConnections()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, conn := range t.pending {
+		_ = conn.Close()
+		delete(t.pending, addr)
+	}
+}
+
+// dialTunnel dials a connection to addr through the proxy, by the CONNECT
+// method of http and https proxies, or by socks5.
+func dialTunnel(ctx context.Context, d *dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		socks, err := proxy.SOCKS5("tcp", proxyAddr(proxyURL), auth, d)
+		if err != nil {
+			return nil, WrapErr(err, "socks5 proxy error")
+		}
+		return socks.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	case "http", "https":
+	default:
+		return nil, WrapErrf(ErrProxyTunnel, "unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr(proxyURL))
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+	// Close the connection if ctx is done while the tunnel is being set up.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	err = proxyConnect(conn, connectReq)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// proxyConnect sends the CONNECT request over conn and reads the response.
+// The proxy sends nothing more until the TLS handshake, so the reader only
+// buffers the response.
+func proxyConnect(conn net.Conn, connectReq *http.Request) error {
+	if err := connectReq.Write(conn); err != nil {
+		return err
+	}
+	// The body is not closed, which would read the tunnel until EOF.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return WrapErrf(ErrProxyTunnel, "proxy CONNECT %s: %s", connectReq.Host, resp.Status)
+	}
+	return nil
+}
+
+// proxyAddr returns the host and port of proxy, with the default port of
+// its scheme.
+func proxyAddr(proxyURL *url.URL) string {
+	if port := proxyURL.Port(); port != "" {
+		return net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	port := "80"
+	switch proxyURL.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
@@ -0,0 +1,183 @@
+package direwolf
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newHelloServer starts a https server which records the last ClientHello.
+func newHelloServer(hello *atomic.Value) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	ts.TLS = &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello.Store(info)
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	return ts
+}
+
+// newConnectProxy starts a proxy which tunnels CONNECT requests.
+func newConnectProxy(connects *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		atomic.AddInt32(connects, 1)
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			_ = target.Close()
+			return
+		}
+		go func() {
+			_, _ = io.Copy(target, conn)
+			_ = target.Close()
+		}()
+		_, _ = io.Copy(conn, target)
+		_ = conn.Close()
+	}))
+}
+
+// isGREASE reports whether the value is a GREASE value, which is sent by
+// Chrome but not by Go.
+func isGREASE(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+func TestProfileTLSFingerprint(t *testing.T) {
+	var hello atomic.Value
+	ts := newHelloServer(&hello)
+	defer ts.Close()
+
+	resp, err := NewSession().Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := hello.Load().(*tls.ClientHelloInfo); isGREASE(info.CipherSuites[0]) {
+		t.Fatal("Session without Profile should send the ClientHello of Go.")
+	}
+
+	options := DefaultSessionOptions()
+	options.Profile = ProfileChrome()
+	session := NewSession(options)
+	resp, err = session.Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := hello.Load().(*tls.ClientHelloInfo)
+	if !isGREASE(info.CipherSuites[0]) || strings.Join(info.SupportedProtos, ",") != "h2,http/1.1" {
+		t.Fatal("Profile should send the ClientHello of browser: ", info.CipherSuites, info.SupportedProtos)
+	}
+	if resp.Text() != "HTTP/1.1" || resp.Timings.TLSHandshake <= 0 {
+		t.Fatal("Profile should send https request by HTTP/1.1 if the server selects it: ", resp.Text())
+	}
+
+	var connects int32
+	proxyServer := newConnectProxy(&connects)
+	defer proxyServer.Close()
+	hello.Store(&tls.ClientHelloInfo{})
+	resp, err = session.Get(ts.URL, InsecureSkipVerify(true), &Proxy{HTTPS: proxyServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = hello.Load().(*tls.ClientHelloInfo)
+	if atomic.LoadInt32(&connects) != 1 || len(info.CipherSuites) == 0 || !isGREASE(info.CipherSuites[0]) {
+		t.Fatal("Profile should keep the ClientHello through proxy.")
+	}
+}
+
+func TestProfileTLSFingerprintHTTP2(t *testing.T) {
+	var hello atomic.Value
+	var handshakes int32
+	ts := httptest.NewUnstartedServer(newProtoHandler())
+	ts.EnableHTTP2 = true
+	ts.TLS = &tls.Config{
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			atomic.AddInt32(&handshakes, 1)
+			hello.Store(info)
+			return nil, nil
+		},
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.Profile = ProfileChrome()
+	session := NewSession(options)
+	for i := 0; i < 2; i++ {
+		resp, err := session.Get(ts.URL, InsecureSkipVerify(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != "HTTP/2.0" {
+			t.Fatal("Profile should send https request by HTTP/2 if the server selects it: ", resp.Text())
+		}
+	}
+	if n := atomic.LoadInt32(&handshakes); n != 1 {
+		t.Fatal("the connection which learned the protocol should be reused: ", n)
+	}
+
+	var connects int32
+	proxyServer := newConnectProxy(&connects)
+	defer proxyServer.Close()
+	resp, err := session.Get(ts.URL, InsecureSkipVerify(true), &Proxy{HTTPS: proxyServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "HTTP/2.0" || atomic.LoadInt32(&connects) != 1 {
+		t.Fatal("Profile should send https request by HTTP/2 through proxy: ", resp.Text())
+	}
+
+	options.DisableHTTP2 = true
+	resp, err = NewSession(options).Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := hello.Load().(*tls.ClientHelloInfo)
+	if resp.Text() != "HTTP/1.1" || strings.Join(info.SupportedProtos, ",") != "http/1.1" {
+		t.Fatal("Profile should only offer HTTP/1.1 with DisableHTTP2: ", resp.Text(), info.SupportedProtos)
+	}
+}
+
+func TestProfileUnknownTLSFingerprint(t *testing.T) {
+	profile := ProfileChrome()
+	profile.TLSFingerprint = "netscape"
+	options := DefaultSessionOptions()
+	options.Profile = profile
+	if NewSession(options) != nil {
+		t.Fatal("NewSession should fail with unknown TLS fingerprint.")
+	}
+}
+
+func TestTunnelTransportEviction(t *testing.T) {
+	direct := &http.Transport{}
+	trans := newTunnelTransport(direct, &dialer{netDialer: &net.Dialer{}}, DefaultSessionOptions())
+	first := trans.tunnel(&url.URL{Scheme: "http", Host: "127.0.0.1:10000"})
+	for i := 1; i <= maxTunnelTransports; i++ {
+		trans.tunnel(&url.URL{Scheme: "http", Host: "127.0.0.1:" + strconv.Itoa(10000+i)})
+	}
+	if n := trans.tunnels.list.Len(); n != maxTunnelTransports {
+		t.Fatal("tunnelTransport should keep the Transports of recent proxies only: ", n)
+	}
+	if trans.tunnel(&url.URL{Scheme: "http", Host: "127.0.0.1:10000"}) == first {
+		t.Fatal("the Transport of the least recently used proxy should be evicted.")
+	}
+}
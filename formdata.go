@@ -2,63 +2,328 @@ package direwolf
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
+	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
+// quoteEscaper escapes the quotes in Content-Disposition, the same as mime/multipart.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// errPartConsumed is returned when the io.Reader of a part is sent again.
+var errPartConsumed = errors.New("the reader of multipart form part has been consumed")
+
+// MultipartForm is a multipart/form-data body. Files and readers are not read
+// when they are written to the form, but streamed when the request is sent,
+// so large files are not loaded into memory.
 type MultipartForm struct {
-	body *bytes.Buffer
-	m    *multipart.Writer
+	boundary string
+	parts    []*formPart
 }
 
-func NewMultipartForm() *MultipartForm {
-	body := bytes.Buffer{}
-	w := multipart.NewWriter(&body)
+// formPart records a field, file or reader written to MultipartForm.
+type formPart struct {
+	key         string
+	value       string
+	filePath    string
+	reader      io.Reader
+	consumed    bool
+	size        int64 // -1 if unknown
+	fileName    string
+	contentType string
+	header      http.Header
+}
 
-	mf := MultipartForm{
-		body: &body,
-		m:    w,
-	}
-	return &mf
+// PartOptions is the options of a file or reader part of MultipartForm.
+type PartOptions struct {
+	// FileName is the filename of Content-Disposition. For WriteFile, the base
+	// name of the file is used if it is empty.
+	FileName string
+
+	// ContentType of the part, default is application/octet-stream.
+	ContentType string
+
+	// Header is the additional headers of the part.
+	Header http.Header
 }
 
-func (mf *MultipartForm) WriteField(key, value string) error {
-	return mf.m.WriteField(key, value)
+func NewMultipartForm() *MultipartForm {
+	return &MultipartForm{boundary: multipart.NewWriter(io.Discard).Boundary()}
 }
 
-func (mf *MultipartForm) WriteFile(key, filePath string) error {
-	_, fileName := filepath.Split(filePath)
+func (mf *MultipartForm) WriteField(key, value string) error {
+	mf.parts = append(mf.parts, &formPart{key: key, value: value, size: int64(len(value))})
+	return nil
+}
 
-	fw, err := mf.m.CreateFormFile(key, fileName)
+// WriteFile adds the file to form. The file is read when the request is sent,
+// it returns error if the file can not be accessed now.
+func (mf *MultipartForm) WriteFile(key, filePath string, options ...*PartOptions) error {
+	info, err := os.Stat(filePath)
 	if err != nil {
 		return err
 	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", filePath)
+	}
+	part := newFilePart(key, options)
+	part.filePath = filePath
+	part.size = info.Size()
+	if part.fileName == "" {
+		_, part.fileName = filepath.Split(filePath)
+	}
+	mf.parts = append(mf.parts, part)
+	return nil
+}
 
-	f, err := os.Open(filePath)
-	if err != nil {
-		return err
+// WriteReader adds the content of r to form, size is the length of content,
+// or -1 if it is unknown. The Content-Length of request is unknown if the size
+// of any part is unknown, then the body is sent by chunked encoding.
+//
+// The reader can be read only once, so the request can not be sent again, and
+// is not redirected by 307 or 308 status. Set PartOptions.FileName so that the
+// server treats the part as a file.
+func (mf *MultipartForm) WriteReader(key string, r io.Reader, size int64, options ...*PartOptions) error {
+	if size < 0 {
+		size = -1
 	}
-	defer f.Close()
+	part := newFilePart(key, options)
+	part.reader = r
+	part.size = size
+	mf.parts = append(mf.parts, part)
+	return nil
+}
 
-	_, err = io.Copy(fw, f)
-	return err
+// newFilePart new a file part with the last PartOptions.
+func newFilePart(key string, options []*PartOptions) *formPart {
+	part := &formPart{key: key, contentType: "application/octet-stream"}
+	if len(options) > 0 && options[len(options)-1] != nil {
+		opts := options[len(options)-1]
+		part.fileName = opts.FileName
+		part.header = opts.Header
+		if opts.ContentType != "" {
+			part.contentType = opts.ContentType
+		}
+	}
+	return part
 }
 
+// Close is kept for compatibility, the closing boundary is written when the
+// form is sent.
 func (mf *MultipartForm) Close() error {
-	return mf.m.Close()
+	return nil
 }
 
+// Reader reads the whole form into memory, use it for small forms only.
+// The parts of io.Reader are consumed.
 func (mf *MultipartForm) Reader() *bytes.Reader {
-	return bytes.NewReader(mf.body.Bytes())
+	var buf bytes.Buffer
+	_ = mf.writeTo(&buf)
+	return bytes.NewReader(buf.Bytes())
 }
 
 func (mf *MultipartForm) ContentType() string {
-	return mf.m.FormDataContentType()
+	return "multipart/form-data; boundary=" + mf.boundary
+}
+
+// ContentLength returns the length of the form body, or -1 if the size of
+// any part is unknown.
+func (mf *MultipartForm) ContentLength() int64 {
+	counter := &countWriter{}
+	w := multipart.NewWriter(counter)
+	_ = w.SetBoundary(mf.boundary)
+	for _, part := range mf.parts {
+		if part.size < 0 {
+			return -1
+		}
+		if _, err := w.CreatePart(part.mimeHeader()); err != nil {
+			return -1
+		}
+		counter.n += part.size
+	}
+	_ = w.Close()
+	return counter.n
+}
+
+// consumed reports whether a part of io.Reader has been sent, then the form
+// can not be sent again.
+func (mf *MultipartForm) consumed() bool {
+	for _, part := range mf.parts {
+		if part.consumed {
+			return true
+		}
+	}
+	return false
+}
+
+// rereadable reports whether the form can be sent again.
+func (mf *MultipartForm) rereadable() bool {
+	for _, part := range mf.parts {
+		if part.reader != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// body returns the streaming body of the form.
+func (mf *MultipartForm) body() io.ReadCloser {
+	return &formBody{form: mf}
+}
+
+// writeTo writes the form to w.
+func (mf *MultipartForm) writeTo(w io.Writer) error {
+	m := multipart.NewWriter(w)
+	if err := m.SetBoundary(mf.boundary); err != nil {
+		return err
+	}
+	for _, part := range mf.parts {
+		pw, err := m.CreatePart(part.mimeHeader())
+		if err != nil {
+			return err
+		}
+		if err := part.writeTo(pw); err != nil {
+			return err
+		}
+	}
+	return m.Close()
+}
+
+// writePreview writes the form to w like writeTo, but the content of file and
+// reader parts is replaced by a placeholder, so nothing is read or consumed.
+func (mf *MultipartForm) writePreview(w io.Writer) error {
+	m := multipart.NewWriter(w)
+	if err := m.SetBoundary(mf.boundary); err != nil {
+		return err
+	}
+	for _, part := range mf.parts {
+		pw, err := m.CreatePart(part.mimeHeader())
+		if err != nil {
+			return err
+		}
+		content := part.value
+		switch {
+		case part.filePath != "":
+			content = "<file: " + part.filePath + ">"
+		case part.reader != nil:
+			content = "<reader part>"
+		}
+		if _, err := io.WriteString(pw, content); err != nil {
+			return err
+		}
+	}
+	return m.Close()
 }
 
 func (mf *MultipartForm) bindRequest(request *Request) error {
 	request.MultipartForm = mf
 	return nil
 }
+
+// mimeHeader returns the headers of part.
+func (part *formPart) mimeHeader() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	if part.filePath == "" && part.reader == nil {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(part.key)))
+		return h
+	}
+	for key, values := range part.header {
+		h[textproto.CanonicalMIMEHeaderKey(key)] = values
+	}
+	if part.fileName != "" {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(part.key), quoteEscaper.Replace(part.fileName)))
+	} else {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(part.key)))
+	}
+	h.Set("Content-Type", part.contentType)
+	return h
+}
+
+// writeTo writes the content of part to w. The content must be as long as the
+// size of part, so that the Content-Length is right.
+func (part *formPart) writeTo(w io.Writer) error {
+	var r io.Reader
+	switch {
+	case part.filePath != "":
+		f, err := os.Open(part.filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	case part.reader != nil:
+		if part.consumed {
+			return errPartConsumed
+		}
+		part.consumed = true
+		r = part.reader
+	default:
+		_, err := io.WriteString(w, part.value)
+		return err
+	}
+
+	if part.size < 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	if _, err := io.CopyN(w, r, part.size); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("part %s is shorter than %d bytes", part.key, part.size)
+		}
+		return err
+	}
+	return nil
+}
+
+// formBody streams the form through io.Pipe. The goroutine writing the form
+// starts at the first Read, so the body which is never sent costs nothing.
+type formBody struct {
+	form *MultipartForm
+	once sync.Once
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+}
+
+func (body *formBody) start() {
+	body.once.Do(func() {
+		body.pr, body.pw = io.Pipe()
+		go func() {
+			_ = body.pw.CloseWithError(body.form.writeTo(body.pw))
+		}()
+	})
+}
+
+func (body *formBody) Read(p []byte) (int, error) {
+	body.start()
+	if body.pr == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return body.pr.Read(p)
+}
+
+// Close stops the goroutine writing the form.
+func (body *formBody) Close() error {
+	body.once.Do(func() {}) // never start after closed
+	if body.pr != nil {
+		return body.pr.Close()
+	}
+	return nil
+}
+
+// countWriter counts the bytes written.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
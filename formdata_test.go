@@ -0,0 +1,141 @@
+package direwolf
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newMultipartHandler responds the Content-Length, Transfer-Encoding and the
+// parts of multipart form.
+func newMultipartHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("X-Content-Length", strconv.FormatInt(r.ContentLength, 10))
+		w.Header().Set("X-Transfer-Encoding", strings.Join(r.TransferEncoding, ","))
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			content, _ := io.ReadAll(part)
+			_, _ = w.Write([]byte(part.FormName() + "|" + part.FileName() + "|" +
+				part.Header.Get("Content-Type") + "|" + part.Header.Get("X-Part") + "|" + string(content) + "\n"))
+		}
+	})
+}
+
+func TestMultipartFormStream(t *testing.T) {
+	ts := httptest.NewServer(newMultipartHandler(t))
+	defer ts.Close()
+
+	filePath := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(filePath, []byte(strings.Repeat("a", 100000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mf := NewMultipartForm()
+	_ = mf.WriteField("name", "direwolf")
+	if err := mf.WriteFile("file", filePath, &PartOptions{
+		ContentType: "text/plain",
+		Header:      http.Header{"X-Part": {"1"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_ = mf.WriteReader("reader", strings.NewReader("from reader"), 11, &PartOptions{FileName: "r.bin"})
+	var transferred, total int64
+	progress := UploadProgress(func(n, size int64) { transferred, total = n, size })
+
+	resp, err := Post(ts.URL, mf, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "name||||direwolf\n" +
+		"file|a.txt|text/plain|1|" + strings.Repeat("a", 100000) + "\n" +
+		"reader|r.bin|application/octet-stream||from reader\n"
+	if resp.Text() != want {
+		t.Fatal("MultipartForm parts failed: ", resp.Text()[:100])
+	}
+	length := mf.ContentLength()
+	if resp.Headers.Get("X-Content-Length") != strconv.FormatInt(length, 10) {
+		t.Fatal("MultipartForm Content-Length failed: ", resp.Headers.Get("X-Content-Length"), length)
+	}
+	if transferred != length || total != length {
+		t.Fatal("MultipartForm progress failed: ", transferred, total)
+	}
+
+	if _, err := Post(ts.URL, mf); !errors.Is(err, errPartConsumed) {
+		t.Fatal("MultipartForm with consumed reader should fail before sent: ", err)
+	}
+}
+
+func TestMultipartFormUploadProgress(t *testing.T) {
+	ts := httptest.NewServer(newMultipartHandler(t))
+	defer ts.Close()
+
+	filePath := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(filePath, []byte(strings.Repeat("a", 100000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mf := NewMultipartForm()
+	_ = mf.WriteField("name", "direwolf")
+	_ = mf.WriteFile("file", filePath)
+	var transferred, total int64
+	progress := UploadProgress(func(n, size int64) {
+		if n < transferred {
+			t.Error("upload progress should not restart: ", n, transferred)
+		}
+		transferred, total = n, size
+	})
+
+	// The body logging reads the form again by GetBody, which is not reported.
+	options := DefaultSessionOptions()
+	options.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	options.LogVerbosity = LogBodies
+	if _, err := NewSession(options).Post(ts.URL, mf, progress); err != nil {
+		t.Fatal(err)
+	}
+	if transferred != mf.ContentLength() || total != mf.ContentLength() {
+		t.Fatal("upload progress of MultipartForm failed: ", transferred, total)
+	}
+}
+
+func TestMultipartFormUnknownSize(t *testing.T) {
+	ts := httptest.NewServer(newMultipartHandler(t))
+	defer ts.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write([]byte("streamed"))
+		_ = pw.Close()
+	}()
+	mf := NewMultipartForm()
+	_ = mf.WriteReader("reader", pr, -1)
+	if mf.ContentLength() != -1 {
+		t.Fatal("ContentLength should be unknown: ", mf.ContentLength())
+	}
+	resp, err := Post(ts.URL, mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers.Get("X-Transfer-Encoding") != "chunked" {
+		t.Fatal("MultipartForm with unknown size should be chunked: ", resp.Headers)
+	}
+	if resp.Text() != "reader||application/octet-stream||streamed\n" {
+		t.Fatal("MultipartForm reader part failed: ", resp.Text())
+	}
+}
@@ -1,14 +1,38 @@
 module github.com/wnanbei/direwolf
 
-go 1.12
+go 1.21
 
 require (
 	github.com/PuerkitoBio/goquery v1.5.0
-	github.com/andybalholm/cascadia v1.1.0 // indirect
+	github.com/andybalholm/brotli v1.0.6
 	github.com/gin-gonic/gin v1.7.7
-	github.com/json-iterator/go v1.1.9
+	github.com/json-iterator/go v1.1.12
+	github.com/klauspost/compress v1.17.4
+	github.com/refraction-networking/utls v1.6.7
 	github.com/tidwall/gjson v1.14.0
+	github.com/ugorji/go/codec v1.1.7
 	github.com/valyala/fasthttp v1.35.0
-	golang.org/x/net v0.0.0-20220225172249-27dd8689420f
-	golang.org/x/text v0.3.7
+	golang.org/x/net v0.35.0
+	golang.org/x/text v0.22.0
+	google.golang.org/protobuf v1.36.5
+	gopkg.in/yaml.v2 v2.2.8
+)
+
+require (
+	github.com/andybalholm/cascadia v1.1.0 // indirect
+	github.com/cloudflare/circl v1.3.7 // indirect
+	github.com/gin-contrib/sse v0.1.0 // indirect
+	github.com/go-playground/locales v0.13.0 // indirect
+	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/go-playground/validator/v10 v10.4.1 // indirect
+	github.com/golang/protobuf v1.5.0 // indirect
+	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
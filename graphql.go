@@ -0,0 +1,330 @@
+package direwolf
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// GraphQLOptions is the options of Session.GraphQL, pass it in the args of
+// GraphQL.
+type GraphQLOptions struct {
+	// OperationName selects the operation if the query has many.
+	OperationName string
+
+	// PersistedQuery, if true, sends the sha256 hash of query instead of the
+	// query, as defined by Apollo automatic persisted queries. The query is
+	// sent again with the hash if the server does not know it.
+	PersistedQuery bool
+}
+
+// RequestOption interface method. GraphQLOptions is used by Session.GraphQL,
+// it does not change the request.
+func (options *GraphQLOptions) bindRequest(request *Request) error {
+	return nil
+}
+
+// GraphQLUpload is a file in the variables of GraphQL, it is sent by the
+// GraphQL multipart request spec: https://github.com/jaydenseric/graphql-multipart-request-spec
+// Set FilePath to upload a file, or Reader and Size to upload its content,
+// Size is zero or negative if unknown.
+type GraphQLUpload struct {
+	FilePath    string
+	Reader      io.Reader
+	Size        int64
+	FileName    string
+	ContentType string
+}
+
+// GraphQLLocation is the location of error in GraphQL query.
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an error in the errors of GraphQL response.
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations"`
+	// Path is the path of response field, the elements are string keys or
+	// int indexes.
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+func (e *GraphQLError) Error() string {
+	msg := e.Message
+	if len(e.Path) > 0 {
+		path := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			path[i] = fmt.Sprint(p)
+		}
+		msg += " (path: " + strings.Join(path, ".") + ")"
+	}
+	for _, location := range e.Locations {
+		msg += fmt.Sprintf(" (line %d, column %d)", location.Line, location.Column)
+	}
+	return msg
+}
+
+// GraphQLErrors is the errors of GraphQL response. Use errors.As to get it
+// from the error returned by Session.GraphQL.
+type GraphQLErrors []*GraphQLError
+
+func (errs GraphQLErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns the errors, so that errors.As can find each GraphQLError.
+func (errs GraphQLErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+	return unwrapped
+}
+
+// graphQLRequest is the standard envelope of GraphQL request.
+type graphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// graphQLResponse is the standard envelope of GraphQL response.
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors GraphQLErrors   `json:"errors"`
+}
+
+// GraphQL posts the query and variables to GraphQL endpoint, and decodes the
+// data of response into out. The request is built from args like Post, so
+// the headers, cookies and proxy of Session are used, and ctx cancels it like
+// SendContext. Pass *GraphQLOptions in args to set the operation name or use
+// persisted queries.
+//
+// The GraphQLUpload in variables, including in the nested maps and slices,
+// are uploaded as files. If there are uploads, the persisted query is sent
+// with the query at once, so the files are uploaded only once. If the
+// response has errors, the data is still decoded and GraphQLErrors is
+// returned.
+func (session *Session) GraphQL(ctx context.Context, endpoint, query string, variables map[string]interface{}, out interface{}, args ...RequestOption) error {
+	options := &GraphQLOptions{}
+	for _, arg := range args {
+		if o, ok := arg.(*GraphQLOptions); ok {
+			options = o
+		}
+	}
+	payload := &graphQLRequest{
+		Query:         query,
+		OperationName: options.OperationName,
+	}
+	var uploads []*graphQLUploadPath
+	if variables != nil {
+		payload.Variables = extractUploads(variables, "variables", &uploads).(map[string]interface{})
+	}
+
+	if options.PersistedQuery {
+		hash := sha256.Sum256([]byte(query))
+		payload.Extensions = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hex.EncodeToString(hash[:]),
+			},
+		}
+	}
+	// The hash only request is skipped if there are uploads, because the
+	// readers of uploads can not be sent again.
+	if options.PersistedQuery && len(uploads) == 0 {
+		payload.Query = ""
+		result, err := session.sendGraphQL(ctx, endpoint, payload, nil, args)
+		if err != nil || !result.persistedQueryNotFound() {
+			return decodeGraphQLResult(result, err, out)
+		}
+		payload.Query = query
+	}
+	result, err := session.sendGraphQL(ctx, endpoint, payload, uploads, args)
+	return decodeGraphQLResult(result, err, out)
+}
+
+// sendGraphQL sends the payload, by multipart form if there are uploads.
+func (session *Session) sendGraphQL(ctx context.Context, endpoint string, payload *graphQLRequest, uploads []*graphQLUploadPath, args []RequestOption) (*graphQLResponse, error) {
+	data, err := jsoniter.Marshal(payload)
+	if err != nil {
+		return nil, WrapErr(err, "marshal graphql request failed")
+	}
+
+	var req *Request
+	if len(uploads) > 0 {
+		form, err := graphQLForm(data, uploads)
+		if err != nil {
+			return nil, err
+		}
+		req, err = NewRequest("POST", endpoint, append(args[:len(args):len(args)], form)...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if req, err = NewRequest("POST", endpoint, args...); err != nil {
+			return nil, err
+		}
+		req.JsonBody = data
+	}
+	if req.Headers == nil {
+		req.Headers = http.Header{}
+	}
+	if req.Headers.Get("Accept") == "" {
+		req.Headers.Set("Accept", "application/graphql-response+json, application/json")
+	}
+
+	resp, err := session.SendContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+	if !isJSONMediaType(mediaType) {
+		if resp.StatusCode >= 400 {
+			return nil, newProblemError(resp, mediaType)
+		}
+		return nil, WrapErrf(ErrContentType, "response is not json: %s", resp.Headers.Get("Content-Type"))
+	}
+	result := &graphQLResponse{}
+	if err := jsoniter.Unmarshal(resp.Content, result); err != nil {
+		return nil, WrapErr(err, "decode graphql response failed")
+	}
+	if resp.StatusCode >= 400 && len(result.Errors) == 0 {
+		return nil, newProblemError(resp, mediaType)
+	}
+	for _, err := range result.Errors { // the indexes of path are decoded as float64
+		for i, p := range err.Path {
+			if index, ok := p.(float64); ok {
+				err.Path[i] = int(index)
+			}
+		}
+	}
+	return result, nil
+}
+
+// persistedQueryNotFound reports whether the server does not know the hash
+// of persisted query.
+func (result *graphQLResponse) persistedQueryNotFound() bool {
+	for _, err := range result.Errors {
+		if err.Message == "PersistedQueryNotFound" || err.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeGraphQLResult decodes the data into out, and returns the errors.
+func decodeGraphQLResult(result *graphQLResponse, err error, out interface{}) error {
+	if err != nil {
+		return err
+	}
+	if out != nil && len(result.Data) > 0 && string(result.Data) != "null" {
+		if err := jsoniter.Unmarshal(result.Data, out); err != nil {
+			return WrapErr(err, "decode graphql data failed")
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result.Errors
+	}
+	return nil
+}
+
+// graphQLUploadPath is a GraphQLUpload and its path in operations.
+type graphQLUploadPath struct {
+	upload *GraphQLUpload
+	path   string
+}
+
+// extractUploads returns a copy of v whose GraphQLUploads are replaced by
+// null, and appends them to uploads.
+func extractUploads(v interface{}, path string, uploads *[]*graphQLUploadPath) interface{} {
+	switch value := v.(type) {
+	case *GraphQLUpload:
+		*uploads = append(*uploads, &graphQLUploadPath{upload: value, path: path})
+		return nil
+	case GraphQLUpload:
+		*uploads = append(*uploads, &graphQLUploadPath{upload: &value, path: path})
+		return nil
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			copied[key] = extractUploads(item, path+"."+key, uploads)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = extractUploads(item, path+"."+strconv.Itoa(i), uploads)
+		}
+		return copied
+	case []*GraphQLUpload:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = extractUploads(item, path+"."+strconv.Itoa(i), uploads)
+		}
+		return copied
+	}
+	return v
+}
+
+// graphQLForm builds the multipart form with the operations, map and files.
+func graphQLForm(operations []byte, uploads []*graphQLUploadPath) (*MultipartForm, error) {
+	// The map is written in the order of files, jsoniter does not sort the
+	// keys of map.
+	var fileMap strings.Builder
+	fileMap.WriteByte('{')
+	for i, upload := range uploads {
+		path, err := jsoniter.Marshal([]string{upload.path})
+		if err != nil {
+			return nil, WrapErr(err, "marshal graphql file map failed")
+		}
+		if i > 0 {
+			fileMap.WriteByte(',')
+		}
+		fileMap.WriteString(`"` + strconv.Itoa(i) + `":`)
+		fileMap.Write(path)
+	}
+	fileMap.WriteByte('}')
+
+	form := NewMultipartForm()
+	_ = form.WriteField("operations", string(operations))
+	_ = form.WriteField("map", fileMap.String())
+	for i, upload := range uploads {
+		file := upload.upload
+		options := &PartOptions{FileName: file.FileName, ContentType: file.ContentType}
+		var err error
+		if file.FilePath != "" {
+			err = form.WriteFile(strconv.Itoa(i), file.FilePath, options)
+		} else {
+			if options.FileName == "" { // the servers require filename for uploads
+				options.FileName = "blob"
+			}
+			size := file.Size
+			if size <= 0 {
+				size = -1
+			}
+			err = form.WriteReader(strconv.Itoa(i), file.Reader, size, options)
+		}
+		if err != nil {
+			return nil, WrapErr(err, "write graphql upload failed")
+		}
+	}
+	return form, nil
+}
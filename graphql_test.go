@@ -0,0 +1,144 @@
+package direwolf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newGraphQLHandler serves a fake GraphQL endpoint which knows the hash of
+// persisted query after it is sent once, and echoes the uploaded files.
+func newGraphQLHandler(t *testing.T) http.Handler {
+	persisted := map[string]bool{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Query      string                 `json:"query"`
+			Variables  map[string]interface{} `json:"variables"`
+			Extensions struct {
+				PersistedQuery struct {
+					Hash string `json:"sha256Hash"`
+				} `json:"persistedQuery"`
+			} `json:"extensions"`
+		}
+		w.Header().Set("Content-Type", "application/graphql-response+json")
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := json.Unmarshal([]byte(r.FormValue("operations")), &payload); err != nil {
+				t.Error(err)
+				return
+			}
+			if payload.Query == "" { // the files are read only once
+				t.Error("uploads should be sent with the query")
+				return
+			}
+			files := payload.Variables["files"].([]interface{})
+			if r.FormValue("map") != `{"0":["variables.files.0"],"1":["variables.files.1"]}` || files[0] != nil {
+				w.WriteHeader(400)
+				return
+			}
+			var names []string
+			for _, key := range []string{"0", "1"} {
+				file, header, err := r.FormFile(key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				content, _ := io.ReadAll(file)
+				names = append(names, header.Filename+":"+string(content))
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"files": names}})
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+			return
+		}
+		if hash := payload.Extensions.PersistedQuery.Hash; hash != "" {
+			if payload.Query == "" && !persisted[hash] {
+				_, _ = w.Write([]byte(`{"errors": [{"message": "PersistedQueryNotFound"}]}`))
+				return
+			}
+			persisted[hash] = true
+		}
+		_, _ = w.Write([]byte(`{
+			"data": {"user": {"name": "` + payload.Variables["name"].(string) + `"}, "friends": null},
+			"errors": [{"message": "not allowed", "path": ["friends", 0], "locations": [{"line": 1, "column": 20}]}]
+		}`))
+	})
+}
+
+func TestSessionGraphQL(t *testing.T) {
+	ts := httptest.NewServer(newGraphQLHandler(t))
+	defer ts.Close()
+
+	var out struct {
+		User struct {
+			Name string `json:"name"`
+		} `json:"user"`
+	}
+	session := NewSession()
+	query := `query ($name: String) { user(name: $name) { name } friends { name } }`
+	ctx := context.Background()
+	err := session.GraphQL(ctx, ts.URL, query, map[string]interface{}{"name": "direwolf"}, &out)
+	var errs GraphQLErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatal("GraphQL should return GraphQLErrors: ", err)
+	}
+	var gqlErr *GraphQLError
+	if !errors.As(err, &gqlErr) || gqlErr.Path[0] != "friends" || gqlErr.Path[1] != 0 || gqlErr.Locations[0].Column != 20 {
+		t.Fatal("GraphQLError failed: ", gqlErr)
+	}
+	if out.User.Name != "direwolf" {
+		t.Fatal("GraphQL should decode data with errors: ", out)
+	}
+
+	// The query is sent again if the hash is not found.
+	for i := 0; i < 2; i++ {
+		out.User.Name = ""
+		err = session.GraphQL(ctx, ts.URL, query, map[string]interface{}{"name": "ghost"}, &out,
+			&GraphQLOptions{PersistedQuery: true})
+		if !errors.As(err, &errs) || out.User.Name != "ghost" {
+			t.Fatal("GraphQL persisted query failed: ", err, out)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = session.GraphQL(canceled, ts.URL, query, nil, &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("GraphQL should be canceled by ctx: ", err)
+	}
+}
+
+func TestSessionGraphQLUpload(t *testing.T) {
+	ts := httptest.NewServer(newGraphQLHandler(t))
+	defer ts.Close()
+
+	var out struct {
+		Files []string `json:"files"`
+	}
+	variables := map[string]interface{}{
+		"files": []interface{}{
+			&GraphQLUpload{Reader: strings.NewReader("first"), FileName: "a.txt"},
+			GraphQLUpload{Reader: strings.NewReader("second"), Size: 6},
+		},
+	}
+	// The persisted query is sent with the query, so the readers are sent once.
+	err := NewSession().GraphQL(context.Background(), ts.URL, `mutation ($files: [Upload!]!) { upload(files: $files) }`,
+		variables, &out, &GraphQLOptions{PersistedQuery: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Files) != 2 || out.Files[0] != "a.txt:first" || out.Files[1] != "blob:second" {
+		t.Fatal("GraphQL upload failed: ", out.Files)
+	}
+	if _, ok := variables["files"].([]interface{})[0].(*GraphQLUpload); !ok {
+		t.Fatal("GraphQL should not change the variables.")
+	}
+}
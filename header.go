@@ -0,0 +1,255 @@
+package direwolf
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+)
+
+// OrderedHeaders is the headers which are sent in the insertion order and the
+// original casing of keys, as parameter in Request method. It takes effect
+// when SessionOptions.PreserveHeaderOrder is true, otherwise it is the same as
+// Headers. You should init it by using NewOrderedHeaders.
+type OrderedHeaders struct {
+	pairs [][2]string
+}
+
+// NewOrderedHeaders new a OrderedHeaders type. Just like NewHeaders:
+//
+//	headers := NewOrderedHeaders(
+//		"sec-ch-ua", "value1",
+//		"User-Agent", "value2",
+//	)
+//
+// And if the number of parameters is not a multiple of 2, it will panic.
+func NewOrderedHeaders(keyValue ...string) *OrderedHeaders {
+	if len(keyValue)%2 != 0 {
+		panic("key and value must be part")
+	}
+	h := &OrderedHeaders{}
+	for i := 0; i < len(keyValue)/2; i++ {
+		h.Add(keyValue[i*2], keyValue[i*2+1])
+	}
+	return h
+}
+
+// Add adds the key, value pair to the end of headers.
+func (h *OrderedHeaders) Add(key, value string) {
+	h.pairs = append(h.pairs, [2]string{key, value})
+}
+
+// Header returns the headers as http.Header.
+func (h *OrderedHeaders) Header() http.Header {
+	headers := make(http.Header, len(h.pairs))
+	for _, pair := range h.pairs {
+		headers.Add(pair[0], pair[1])
+	}
+	return headers
+}
+
+// Keys returns the keys of headers in order, repeated keys are removed.
+func (h *OrderedHeaders) Keys() []string {
+	return appendHeaderOrder(nil, h.pairs...)
+}
+
+// RequestOption interface method, bind request option to request.
+func (h *OrderedHeaders) bindRequest(request *Request) error {
+	addHeaders(request, h.Header())
+	request.HeaderOrder = appendHeaderOrder(request.HeaderOrder, h.pairs...)
+	return nil
+}
+
+// RemoveHeaders is the keys of headers which are not sent in the request,
+// even if they are set in Session.Headers, as parameter in Request method:
+//
+//	session.Get(URL, direwolf.RemoveHeaders{"User-Agent"})
+type RemoveHeaders []string
+
+// RequestOption interface method, bind request option to request.
+func (options RemoveHeaders) bindRequest(request *Request) error {
+	if request.Headers == nil {
+		request.Headers = http.Header{}
+	}
+	for _, key := range options {
+		// Empty values deletes the header of Session, see mergeHeaders.
+		request.Headers[http.CanonicalHeaderKey(key)] = []string{}
+	}
+	return nil
+}
+
+// addHeaders adds headers to request, the values of the same key replace the
+// values set before.
+func addHeaders(request *Request, headers http.Header) {
+	if request.Headers == nil {
+		request.Headers = http.Header{}
+	}
+	for key, values := range headers {
+		request.Headers[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+}
+
+// appendHeaderOrder appends the keys of pairs to order, if not in it.
+func appendHeaderOrder(order []string, pairs ...[2]string) []string {
+	for _, pair := range pairs {
+		found := false
+		for _, key := range order {
+			if strings.EqualFold(key, pair[0]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			order = append(order, pair[0])
+		}
+	}
+	return order
+}
+
+// headerOrder returns the order of headers of request, the keys of request
+// come first, then the keys of Session.
+func headerOrder(snapshot *sessionSnapshot, req *Request) []string {
+	order := append([]string(nil), req.HeaderOrder...)
+	for _, key := range snapshot.headerOrder {
+		order = appendHeaderOrder(order, [2]string{key})
+	}
+	return order
+}
+
+// withHeaderOrder returns a context which tells the orderedConn to write the
+// headers of request in order, when the connection is got.
+func withHeaderOrder(ctx context.Context, order []string) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if conn, ok := info.Conn.(*orderedConn); ok {
+				conn.expectHead(order)
+			}
+		},
+	})
+}
+
+// configureHeaderOrder makes the Transport write the header lines of http
+// requests by orderedConn over the connections dialed by dial. https requests
+// are sent by alpnTransport, which writes the headers over HTTP/1.1 by
+// orderedConn too.
+func configureHeaderOrder(trans *http.Transport, dial func(ctx context.Context, network, addr string) (net.Conn, error)) {
+	trans.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &orderedConn{Conn: conn}, nil
+	}
+}
+
+// tlsHandshake runs the TLS handshake over conn, by uTLS if fingerprint is
+// set. ALPN offers HTTP/2 and HTTP/1.1, or HTTP/1.1 only if allowHTTP2 is
+// false.
+func tlsHandshake(ctx context.Context, conn net.Conn, addr string, config *tls.Config, fingerprint TLSFingerprint, allowHTTP2 bool) (net.Conn, error) {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config.ServerName = host
+	}
+	if fingerprint != "" {
+		return utlsHandshake(ctx, conn, config, fingerprint, allowHTTP2)
+	}
+	config.NextProtos = []string{"http/1.1"}
+	if allowHTTP2 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	err := tlsConn.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// orderedConn rewrites the header lines of HTTP/1.1 requests written to the
+// connection, sorts them by the order, and uses the casing of keys in order.
+type orderedConn struct {
+	net.Conn
+	mu      sync.Mutex
+	order   []string
+	pending bool // whether the request head is expected
+	buf     bytes.Buffer
+}
+
+// expectHead tells the connection that the next write is a request head.
+func (c *orderedConn) expectHead(order []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order = order
+	c.pending = len(order) > 0
+	c.buf.Reset()
+}
+
+// Write buffers the request head until it is complete, then writes the
+// reordered head and the rest.
+func (c *orderedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.pending {
+		return c.Conn.Write(p)
+	}
+	c.buf.Write(p)
+	end := bytes.Index(c.buf.Bytes(), []byte("\r\n\r\n"))
+	if end < 0 {
+		return len(p), nil
+	}
+	c.pending = false
+	data := c.buf.Bytes()
+	out := append(reorderHead(data[:end+2], c.order), data[end+2:]...)
+	c.buf.Reset()
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// reorderHead sorts the header lines of request head by order. The head
+// includes the request line, and ends with "\r\n". Headers not in order keep
+// their original order after the ordered ones.
+func reorderHead(head []byte, order []string) []byte {
+	lines := strings.Split(strings.TrimSuffix(string(head), "\r\n"), "\r\n")
+	headerLines := lines[1:]
+	used := make([]bool, len(headerLines))
+
+	var out bytes.Buffer
+	out.WriteString(lines[0] + "\r\n")
+	for _, key := range order {
+		for i, line := range headerLines {
+			colon := strings.IndexByte(line, ':')
+			if used[i] || colon < 0 || !strings.EqualFold(line[:colon], key) {
+				continue
+			}
+			used[i] = true
+			out.WriteString(key + line[colon:] + "\r\n")
+		}
+	}
+	for i, line := range headerLines {
+		if !used[i] {
+			out.WriteString(line + "\r\n")
+		}
+	}
+	return out.Bytes()
+}
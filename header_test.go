@@ -0,0 +1,127 @@
+package direwolf
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newRawHeadServer starts a server which responds the raw request head.
+func newRawHeadServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					var head strings.Builder
+					for {
+						line, err := reader.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line == "\r\n" {
+							break
+						}
+						head.WriteString(line)
+					}
+					body := head.String()
+					_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body))
+				}
+			}(conn)
+		}
+	}()
+	return "http://" + listener.Addr().String()
+}
+
+func TestPreserveHeaderOrder(t *testing.T) {
+	URL := newRawHeadServer(t)
+	options := DefaultSessionOptions()
+	options.PreserveHeaderOrder = true
+	options.Profile = ProfileSafari()
+	session := NewSession(options)
+
+	for i := 0; i < 2; i++ { // the second request reuses the connection
+		resp, err := session.Get(URL, NewOrderedHeaders(
+			"x-first", "1",
+			"User-Agent", "direwolf",
+			"X-MIXED-case", "2",
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(resp.Text()), "\r\n")
+		if lines[1] != "x-first: 1" || lines[2] != "User-Agent: direwolf" || lines[3] != "X-MIXED-case: 2" {
+			t.Fatal("OrderedHeaders should be sent in order and casing: ", lines)
+		}
+		if lines[4] != "Accept: "+ProfileSafari().Header().Get("Accept") || lines[5] != "Sec-Fetch-Site: none" {
+			t.Fatal("Profile headers should be sent in order: ", lines)
+		}
+	}
+}
+
+func TestPreserveHeaderOrderTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(newProtoHandler())
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.PreserveHeaderOrder = true
+	session := NewSession(options)
+	for i := 0; i < 2; i++ { // the second request reuses the connection
+		resp, err := session.Get(ts.URL, InsecureSkipVerify(true), NewOrderedHeaders("b", "1", "a", "2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Proto != "HTTP/2.0" || (i == 0 && resp.Timings.TLSHandshake <= 0) {
+			t.Fatal("PreserveHeaderOrder should send https request by HTTP/2 if the server selects it: ", resp.Proto)
+		}
+	}
+
+	options.DisableHTTP2 = true
+	resp, err := NewSession(options).Get(ts.URL, InsecureSkipVerify(true), NewOrderedHeaders("b", "1", "a", "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/1.1" || resp.Timings.TLSHandshake <= 0 {
+		t.Fatal("PreserveHeaderOrder should send https request by HTTP/1.1 with DisableHTTP2.")
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["X-Multi"] = r.Header["X-Multi"]
+		w.Header()["X-Accept"] = r.Header["Accept"]
+		w.Header()["X-User-Agent"] = r.Header["User-Agent"]
+	}))
+	defer ts.Close()
+
+	session := NewSession()
+	session.Headers.Add("X-Multi", "session")
+	session.Headers.Add("Accept", "text/html")
+	headers := NewHeaders("X-Multi", "1", "X-Multi", "2")
+	resp, err := session.Get(ts.URL, headers, RemoveHeaders{"accept", "User-Agent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(resp.Headers["X-Multi"], ",") != "1,2" {
+		t.Fatal("request header values should replace session values: ", resp.Headers["X-Multi"])
+	}
+	if resp.Headers["X-Accept"] != nil || resp.Headers["X-User-Agent"] != nil {
+		t.Fatal("RemoveHeaders should delete session headers: ", resp.Headers)
+	}
+}
@@ -0,0 +1,71 @@
+package direwolf
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+)
+
+// configureHTTP2 enables HTTP/2 of the Transport for https requests, which is
+// negotiated by TLS ALPN, or disables it if SessionOptions.DisableHTTP2.
+func configureHTTP2(trans *http.Transport, options *SessionOptions) error {
+	if options.DisableHTTP2 {
+		// A non-nil empty TLSNextProto disables HTTP/2.
+		trans.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return nil
+	}
+	h2Trans, err := http2.ConfigureTransports(trans)
+	if err != nil {
+		return WrapErr(err, "configure HTTP/2 failed")
+	}
+	applyHTTP2Options(h2Trans, options)
+	return nil
+}
+
+// applyHTTP2Options sets the HTTP/2 settings in SessionOptions to Transport.
+func applyHTTP2Options(h2Trans *http2.Transport, options *SessionOptions) {
+	h2Trans.ReadIdleTimeout = options.HTTP2ReadIdleTimeout
+	h2Trans.PingTimeout = options.HTTP2PingTimeout
+	h2Trans.MaxHeaderListSize = options.HTTP2MaxHeaderListSize
+}
+
+// h2cTransport sends http requests by cleartext HTTP/2 with prior knowledge,
+// and sends https requests by the fallback RoundTripper.
+type h2cTransport struct {
+	h2c      *http2.Transport
+	fallback http.RoundTripper
+}
+
+// newH2CTransport new a h2cTransport, https requests are sent by fallback.
+func newH2CTransport(fallback http.RoundTripper, dialer *dialer, options *SessionOptions) *h2cTransport {
+	h2c := &http2.Transport{
+		AllowHTTP: true,
+		// Dial a plain TCP connection instead of TLS, so the connection
+		// starts with HTTP/2 directly. The context of request carries the
+		// deadline and the unix socket to dial.
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	applyHTTP2Options(h2c, options)
+	return &h2cTransport{h2c: h2c, fallback: fallback}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of both Transports.
+func (t *h2cTransport) CloseIdleConnections() {
+	t.h2c.CloseIdleConnections()
+	if fallback, ok := t.fallback.(interface{ CloseIdleConnections() }); ok {
+		fallback.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,125 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func newProtoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+}
+
+func TestSessionHTTP2(t *testing.T) {
+	ts := httptest.NewUnstartedServer(newProtoHandler())
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	session := NewSession()
+	resp, err := session.Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/2.0" || resp.Text() != "HTTP/2.0" {
+		t.Fatal("HTTP/2 should be negotiated: ", resp.Proto)
+	}
+
+	options := DefaultSessionOptions()
+	options.DisableHTTP2 = true
+	session = NewSession(options)
+	resp, err = session.Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/1.1" || resp.Text() != "HTTP/1.1" {
+		t.Fatal("DisableHTTP2 failed: ", resp.Proto)
+	}
+}
+
+func TestSessionH2C(t *testing.T) {
+	ts := httptest.NewServer(h2c.NewHandler(newProtoHandler(), &http2.Server{}))
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.H2C = true
+	options.HTTP2MaxHeaderListSize = 1 << 20
+	session := NewSession(options)
+	resp, err := session.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/2.0" || resp.Text() != "HTTP/2.0" {
+		t.Fatal("h2c should be used: ", resp.Proto)
+	}
+	if session.client.Transport.(*h2cTransport).h2c.MaxHeaderListSize != 1<<20 {
+		t.Fatal("HTTP/2 options should be applied.")
+	}
+
+	// Without H2C, the request is sent by HTTP/1.1.
+	resp, err = NewSession().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/1.1" {
+		t.Fatal("h2c should be disabled by default: ", resp.Proto)
+	}
+}
+
+func TestSessionH2CUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "h2c.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(h2c.NewHandler(newProtoHandler(), &http2.Server{}))
+	ts.Listener = listener
+	ts.Start()
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.H2C = true
+	resp, err := NewSession(options).Get("http://docker/info", UnixSocket(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Proto != "HTTP/2.0" {
+		t.Fatal("h2c should be used over unix socket: ", resp.Proto)
+	}
+}
+
+func TestSessionH2CDialContext(t *testing.T) {
+	canceled := make(chan struct{})
+	options := DefaultSessionOptions()
+	options.H2C = true
+	options.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		select { // the dial stalls until the request is canceled
+		case <-ctx.Done():
+			close(canceled)
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("dial is not canceled")
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := NewRequest("GET", "http://example.com")
+	if _, err := NewSession(options).SendContext(ctx, req); err == nil {
+		t.Fatal("request should fail when the dial is canceled.")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(6 * time.Second):
+		t.Fatal("h2c dial should be canceled with the request context.")
+	}
+}
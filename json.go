@@ -0,0 +1,179 @@
+package direwolf
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrContentType is returned when the Content-Type of response is not expected.
+var ErrContentType = errors.New("unexpected content type")
+
+// strictJSON is the same as encoding/json, but rejects unknown fields.
+var strictJSON = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+	DisallowUnknownFields:  true,
+}.Froze()
+
+// StrictJSON, if true, makes the JSON helpers like GetJSON reject the fields
+// of response which are not in the output type.
+type StrictJSON bool
+
+// RequestOption interface method. StrictJSON is used by the JSON helpers, it
+// does not change the request.
+func (options StrictJSON) bindRequest(request *Request) error {
+	return nil
+}
+
+// ProblemError is the error response of JSON helpers, whose status code is
+// 4xx or 5xx. The body of application/problem+json is decoded as defined by
+// RFC 7807, otherwise Type is "about:blank" and Title is the status text.
+type ProblemError struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance"`
+
+	// Extensions is the additional members of problem details.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (e *ProblemError) Error() string {
+	msg := fmt.Sprintf("problem %d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// GetJSON sends a GET request and decodes the JSON response into T. The
+// request is built from URL and args like Session.Get, the default Session
+// is used if session is nil.
+//
+// It returns *ProblemError if the status code is 4xx or 5xx, and
+// ErrContentType if the response is not JSON. The Response is returned
+// with the errors if it is received. Pass StrictJSON(true) in args to reject
+// unknown fields.
+func GetJSON[T any](session *Session, URL string, args ...RequestOption) (T, *Response, error) {
+	return sendJSON[T](session, "GET", URL, nil, args)
+}
+
+// PostJSON marshals body to JSON, sends it by a POST request and decodes the
+// JSON response into Resp, the same as GetJSON.
+func PostJSON[Req, Resp any](session *Session, URL string, body Req, args ...RequestOption) (Resp, *Response, error) {
+	return sendJSON[Resp](session, "POST", URL, body, args)
+}
+
+// PutJSON is the same as PostJSON, but sends a PUT request.
+func PutJSON[Req, Resp any](session *Session, URL string, body Req, args ...RequestOption) (Resp, *Response, error) {
+	return sendJSON[Resp](session, "PUT", URL, body, args)
+}
+
+// PatchJSON is the same as PostJSON, but sends a PATCH request.
+func PatchJSON[Req, Resp any](session *Session, URL string, body Req, args ...RequestOption) (Resp, *Response, error) {
+	return sendJSON[Resp](session, "PATCH", URL, body, args)
+}
+
+// sendJSON sends the request with JSON body if body is not nil, and decodes
+// the response into T.
+func sendJSON[T any](session *Session, method, URL string, body interface{}, args []RequestOption) (T, *Response, error) {
+	var output T
+	if session == nil {
+		session = defaultSession
+	}
+	req, err := NewRequest(method, URL, args...)
+	if err != nil {
+		return output, nil, err
+	}
+	if body != nil {
+		data, err := jsoniter.Marshal(body)
+		if err != nil {
+			return output, nil, WrapErr(err, "marshal json body failed")
+		}
+		req.JsonBody = data
+	}
+	if req.Headers == nil {
+		req.Headers = http.Header{}
+	}
+	if req.Headers.Get("Accept") == "" {
+		req.Headers.Set("Accept", "application/json, application/problem+json")
+	}
+
+	resp, err := session.Send(req)
+	if err != nil {
+		return output, nil, err
+	}
+	strict := false
+	for _, arg := range args {
+		if s, ok := arg.(StrictJSON); ok {
+			strict = bool(s)
+		}
+	}
+	err = decodeJSONResponse(resp, &output, strict)
+	return output, resp, err
+}
+
+// decodeJSONResponse checks the status code and Content-Type of response, and
+// decodes it into output.
+func decodeJSONResponse(resp *Response, output interface{}, strict bool) error {
+	mediaType, _, _ := mime.ParseMediaType(resp.Headers.Get("Content-Type"))
+	if resp.StatusCode >= 400 {
+		return newProblemError(resp, mediaType)
+	}
+	if len(resp.Content) == 0 && (resp.StatusCode == http.StatusNoContent || resp.Request.Method == "HEAD") {
+		return nil
+	}
+	if !isJSONMediaType(mediaType) {
+		return WrapErrf(ErrContentType, "response is not json: %s", resp.Headers.Get("Content-Type"))
+	}
+	api := jsoniter.ConfigDefault
+	if strict {
+		api = strictJSON
+	}
+	if err := api.Unmarshal(resp.Content, output); err != nil {
+		return WrapErr(err, "decode json response failed")
+	}
+	return nil
+}
+
+// newProblemError builds ProblemError from the error response.
+func newProblemError(resp *Response, mediaType string) error {
+	problem := &ProblemError{}
+	if mediaType == "application/problem+json" {
+		if err := jsoniter.Unmarshal(resp.Content, problem); err != nil {
+			return WrapErr(err, "decode problem details failed")
+		}
+		var members map[string]interface{}
+		if err := jsoniter.Unmarshal(resp.Content, &members); err == nil {
+			for _, key := range []string{"type", "title", "status", "detail", "instance"} {
+				delete(members, key)
+			}
+			if len(members) > 0 {
+				problem.Extensions = members
+			}
+		}
+	}
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Status == 0 {
+		problem.Status = resp.StatusCode
+	}
+	if problem.Title == "" && problem.Type == "about:blank" {
+		problem.Title = http.StatusText(resp.StatusCode)
+	}
+	return problem
+}
+
+// isJSONMediaType reports whether mediaType is application/json or a type
+// with +json suffix.
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,99 @@
+package direwolf
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type jsonUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newJSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			if r.Header.Get("Accept") == "" {
+				w.WriteHeader(400)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_, _ = w.Write([]byte(`{"id": 1, "name": "direwolf", "extra": true}`))
+		case "/echo":
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(400)
+				return
+			}
+			w.Header().Set("Content-Type", "application/vnd.api+json")
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		case "/problem":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(403)
+			_, _ = w.Write([]byte(`{"type": "https://example.com/out-of-credit", "title": "You do not have enough credit.",
+				"status": 403, "detail": "Your balance is 30.", "balance": 30}`))
+		case "/html":
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			w.WriteHeader(404)
+		}
+	})
+}
+
+func TestGetJSON(t *testing.T) {
+	ts := httptest.NewServer(newJSONHandler())
+	defer ts.Close()
+
+	user, resp, err := GetJSON[jsonUser](nil, ts.URL+"/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Name != "direwolf" || resp.StatusCode != 200 {
+		t.Fatal("GetJSON failed: ", user)
+	}
+	if _, _, err := GetJSON[jsonUser](NewSession(), ts.URL+"/user", StrictJSON(true)); err == nil {
+		t.Fatal("StrictJSON should reject unknown fields.")
+	}
+	if _, _, err := GetJSON[jsonUser](nil, ts.URL+"/html"); !errors.Is(err, ErrContentType) {
+		t.Fatal("GetJSON should check Content-Type: ", err)
+	}
+
+	var problem *ProblemError
+	_, resp, err = GetJSON[jsonUser](nil, ts.URL+"/problem")
+	if !errors.As(err, &problem) || resp == nil {
+		t.Fatal("GetJSON should return ProblemError: ", err)
+	}
+	if problem.Status != 403 || problem.Type != "https://example.com/out-of-credit" ||
+		problem.Detail != "Your balance is 30." || problem.Extensions["balance"] != float64(30) {
+		t.Fatal("decode problem details failed: ", problem)
+	}
+	_, _, err = GetJSON[jsonUser](nil, ts.URL+"/missing")
+	if !errors.As(err, &problem) || problem.Status != 404 || problem.Type != "about:blank" || problem.Title != "Not Found" {
+		t.Fatal("GetJSON should return ProblemError of status: ", err)
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	ts := httptest.NewServer(newJSONHandler())
+	defer ts.Close()
+
+	user, _, err := PostJSON[jsonUser, jsonUser](nil, ts.URL+"/echo", jsonUser{ID: 2, Name: "ghost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 2 || user.Name != "ghost" {
+		t.Fatal("PostJSON failed: ", user)
+	}
+	user, _, err = PostJSON[map[string]interface{}, jsonUser](nil, ts.URL+"/echo", map[string]interface{}{"id": 3})
+	if err != nil || user.ID != 3 {
+		t.Fatal("PostJSON with map failed: ", user, err)
+	}
+	if _, _, err := PostJSON[float64, jsonUser](nil, ts.URL+"/echo", math.Inf(1)); err == nil {
+		t.Fatal("PostJSON should return marshal error.")
+	}
+}
@@ -0,0 +1,191 @@
+package direwolf
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Logger is the interface of structured logger used by Session. Args are
+// alternating keys and values, the same as log/slog, so *slog.Logger can be
+// used directly.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...interface{})
+}
+
+// LogVerbosity controls how much information is logged for each request.
+type LogVerbosity int
+
+const (
+	// LogBasic logs method, url, status, duration, bytes, attempt and error kind.
+	LogBasic LogVerbosity = iota
+	// LogHeaders logs request and response headers besides LogBasic.
+	LogHeaders
+	// LogBodies logs request and response bodies besides LogHeaders.
+	LogBodies
+)
+
+// logBodyLimit is the max size of body to log, the rest is truncated.
+const logBodyLimit = 2048
+
+// requestEvent is the information about a finished request, it is emitted
+// to logger and other observers of Session.
+type requestEvent struct {
+	request       *Request
+	httpReq       *http.Request
+	response      *Response
+	err           error
+	attempt       int // starts from 1, direwolf does not retry requests by itself
+	start         time.Time
+	duration      time.Duration
+	bytesSent     int64
+	bytesReceived int64
+}
+
+// newRequestEvent new a requestEvent when a request start.
+func newRequestEvent(req *Request) *requestEvent {
+	return &requestEvent{request: req, attempt: 1, start: time.Now()}
+}
+
+// finish records the result of the request.
+func (e *requestEvent) finish(resp *Response, err error) {
+	e.duration = time.Since(e.start)
+	e.response = resp
+	e.err = err
+	if e.httpReq != nil && e.httpReq.ContentLength > 0 {
+		e.bytesSent = e.httpReq.ContentLength
+	}
+	if resp != nil {
+		e.bytesReceived = resp.CompressedSize
+	}
+}
+
+// requestLogger logs the requestEvent with the settings of Session.
+type requestLogger struct {
+	logger        Logger
+	verbosity     LogVerbosity
+	redactHeaders map[string]bool
+	redactParams  map[string]bool
+}
+
+// newRequestLogger new a requestLogger by SessionOptions, it returns nil if
+// there is no Logger. Headers carry secrets are always redacted.
+func newRequestLogger(options *SessionOptions) *requestLogger {
+	if options.Logger == nil {
+		return nil
+	}
+	l := &requestLogger{
+		logger:        options.Logger,
+		verbosity:     options.LogVerbosity,
+		redactHeaders: make(map[string]bool),
+		redactParams:  make(map[string]bool),
+	}
+	for key := range secretHeaders {
+		l.redactHeaders[key] = true
+	}
+	for _, key := range options.LogRedactHeaders {
+		l.redactHeaders[http.CanonicalHeaderKey(key)] = true
+	}
+	for _, key := range options.LogRedactParams {
+		l.redactParams[key] = true
+	}
+	return l
+}
+
+// log emits one event for the request.
+func (l *requestLogger) log(ctx context.Context, e *requestEvent) {
+	level := slog.LevelInfo
+	msg := "direwolf request"
+	args := []interface{}{
+		"method", e.request.Method,
+		"url", l.redactURL(e.request.URL),
+		"duration", e.duration,
+		"bytes_sent", e.bytesSent,
+		"bytes_received", e.bytesReceived,
+		"attempt", e.attempt,
+	}
+	if e.response != nil {
+		args = append(args, "status", e.response.StatusCode)
+	}
+	if e.err != nil {
+		level = slog.LevelError
+		msg = "direwolf request failed"
+		args = append(args, "error_kind", ErrorKind(e.err), "error", e.err.Error())
+	}
+
+	if l.verbosity >= LogHeaders && e.httpReq != nil {
+		args = append(args, "request_headers", l.redactHeader(e.httpReq.Header))
+		if e.response != nil {
+			args = append(args, "response_headers", l.redactHeader(e.response.Headers))
+		}
+	}
+	if l.verbosity >= LogBodies {
+		if e.httpReq != nil && e.httpReq.GetBody != nil {
+			if body, err := readBodyPrefix(e.httpReq, logBodyLimit+1); err == nil {
+				args = append(args, "request_body", truncateBody(body))
+			}
+		}
+		if e.response != nil {
+			args = append(args, "response_body", truncateBody(e.response.Content))
+		}
+	}
+	l.logger.Log(ctx, level, msg, args...)
+}
+
+// redactURL replaces the values of redacted params and password in URL.
+func (l *requestLogger) redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), maskedValue)
+	}
+	if len(l.redactParams) > 0 && u.RawQuery != "" {
+		query := u.Query()
+		for key, values := range query {
+			if l.redactParams[key] {
+				for i := range values {
+					values[i] = maskedValue
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// redactHeader returns a copy of header with redacted values.
+func (l *requestLogger) redactHeader(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for key, values := range header {
+		if l.redactHeaders[http.CanonicalHeaderKey(key)] {
+			h[key] = []string{maskedValue}
+			continue
+		}
+		h[key] = append([]string(nil), values...)
+	}
+	return h
+}
+
+// readBodyPrefix reads at most n bytes of the request body, so that the
+// streaming body of large files is not read into memory.
+func readBodyPrefix(httpReq *http.Request, n int64) ([]byte, error) {
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, n))
+}
+
+// truncateBody returns the body as string, truncated to logBodyLimit.
+func truncateBody(body []byte) string {
+	if len(body) > logBodyLimit {
+		return string(body[:logBodyLimit]) + "...(truncated)"
+	}
+	return string(body)
+}
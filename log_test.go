@@ -0,0 +1,114 @@
+package direwolf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLogger records the logged events.
+type testLogger struct {
+	mu     sync.Mutex
+	events []map[string]interface{}
+	levels []slog.Level
+}
+
+func (l *testLogger) Log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	event := map[string]interface{}{"msg": msg}
+	for i := 0; i+1 < len(args); i += 2 {
+		event[args[i].(string)] = args[i+1]
+	}
+	l.events = append(l.events, event)
+	l.levels = append(l.levels, level)
+}
+
+func newTestLogServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "secret-cookie"})
+		_, _ = w.Write([]byte("hello"))
+	}))
+}
+
+func TestSessionLogger(t *testing.T) {
+	ts := newTestLogServer()
+	defer ts.Close()
+
+	logger := &testLogger{}
+	options := DefaultSessionOptions()
+	options.Logger = logger
+	options.LogVerbosity = LogBodies
+	options.LogRedactParams = []string{"token"}
+	options.LogRedactHeaders = []string{"X-Secret"}
+	session := NewSession(options)
+
+	_, err := session.Post(ts.URL,
+		NewParams("token", "secret-token", "page", "1"),
+		NewHeaders("Authorization", "Bearer secret-auth", "X-Secret", "secret-header"),
+		Body("request body"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := logger.events[0]
+	if event["method"] != "POST" || event["status"] != 200 || event["attempt"] != 1 ||
+		event["bytes_sent"] != int64(12) || event["bytes_received"] != int64(5) {
+		t.Fatal("Logger basic fields failed: ", event)
+	}
+	if url := event["url"].(string); !strings.Contains(url, "token=%2A%2A%2A") || !strings.Contains(url, "page=1") {
+		t.Fatal("Logger should redact params: ", url)
+	}
+	reqHeaders := event["request_headers"].(http.Header)
+	respHeaders := event["response_headers"].(http.Header)
+	if reqHeaders.Get("Authorization") != "***" || reqHeaders.Get("X-Secret") != "***" || respHeaders.Get("Set-Cookie") != "***" {
+		t.Fatal("Logger should redact headers.")
+	}
+	if event["request_body"] != "request body" || event["response_body"] != "hello" {
+		t.Fatal("Logger bodies failed.")
+	}
+
+	_, err = session.Get("http://127.0.0.1:1")
+	if err == nil {
+		t.Fatal("request should fail.")
+	}
+	if logger.levels[1] != slog.LevelError || logger.events[1]["error_kind"] != ErrorKindConnect {
+		t.Fatal("Logger error event failed: ", logger.events[1])
+	}
+}
+
+func TestSessionSlogLogger(t *testing.T) {
+	ts := newTestLogServer()
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	options := DefaultSessionOptions()
+	options.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	session := NewSession(options)
+	if _, err := session.Get(ts.URL, NewHeaders("Cookie", "a=b")); err != nil {
+		t.Fatal(err)
+	}
+
+	event := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event["method"] != "GET" || event["status"] != float64(200) || event["request_headers"] != nil {
+		t.Fatal("slog logger failed: ", buf.String())
+	}
+}
+
+func TestErrorKind(t *testing.T) {
+	if ErrorKind(nil) != "" || ErrorKind(WrapErr(ErrTimeout, "")) != ErrorKindTimeout ||
+		ErrorKind(WrapErr(context.Canceled, "")) != ErrorKindCanceled ||
+		ErrorKind(&RedirectError{1}) != ErrorKindRedirect || ErrorKind(ErrRequestBody) != ErrorKindOther {
+		t.Fatal("ErrorKind failed.")
+	}
+}
@@ -0,0 +1,79 @@
+package direwolf
+
+import "container/list"
+
+// lruCache is a map with a capacity, which evicts the least recently used
+// entry when it is full. It is not safe for concurrent use.
+type lruCache[K comparable, V any] struct {
+	capacity int
+	onEvict  func(key K, value V) // called with the evicted entries, can be nil
+	list     *list.List           // the most recently used entry is the front
+	items    map[K]*list.Element
+}
+
+// lruEntry is the entry of lruCache.
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache new a lruCache holding capacity entries at most.
+func newLRUCache[K comparable, V any](capacity int, onEvict func(key K, value V)) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		capacity: capacity,
+		onEvict:  onEvict,
+		list:     list.New(),
+		items:    make(map[K]*list.Element),
+	}
+}
+
+// get returns the value of key, and marks it as recently used.
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.list.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+// add adds or replaces the value of key, and evicts the least recently used
+// entry if the cache is full.
+func (c *lruCache[K, V]) add(key K, value V) {
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry[K, V]).value = value
+		c.list.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.list.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.list.Len() > c.capacity {
+		c.removeElement(c.list.Back())
+	}
+}
+
+// remove removes key from the cache, onEvict is not called.
+func (c *lruCache[K, V]) remove(key K) {
+	if elem, ok := c.items[key]; ok {
+		c.list.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// each calls f with all entries, from the most recently used one.
+func (c *lruCache[K, V]) each(f func(key K, value V)) {
+	for elem := c.list.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry[K, V])
+		f(entry.key, entry.value)
+	}
+}
+
+// removeElement evicts the entry of elem.
+func (c *lruCache[K, V]) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruEntry[K, V])
+	c.list.Remove(elem)
+	delete(c.items, entry.key)
+	if c.onEvict != nil {
+		c.onEvict(entry.key, entry.value)
+	}
+}
@@ -0,0 +1,32 @@
+package direwolf
+
+import "testing"
+
+func TestLRUCache(t *testing.T) {
+	var evicted []string
+	cache := newLRUCache(2, func(key string, value int) {
+		evicted = append(evicted, key)
+	})
+	cache.add("a", 1)
+	cache.add("b", 2)
+	if value, ok := cache.get("a"); !ok || value != 1 {
+		t.Fatal("lruCache get failed.")
+	}
+	cache.add("c", 3) // b is the least recently used
+	if _, ok := cache.get("b"); ok || len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatal("lruCache should evict the least recently used entry: ", evicted)
+	}
+
+	cache.add("a", 4)
+	cache.remove("c")
+	var keys []string
+	cache.each(func(key string, value int) {
+		keys = append(keys, key)
+	})
+	if len(keys) != 1 || keys[0] != "a" || len(evicted) != 1 {
+		t.Fatal("lruCache add and remove failed: ", keys, evicted)
+	}
+	if value, _ := cache.get("a"); value != 4 {
+		t.Fatal("lruCache should replace the value.")
+	}
+}
@@ -0,0 +1,302 @@
+package direwolf
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives the metrics of requests sent by Session.
+// It must be safe for concurrent use.
+type MetricsCollector interface {
+	// RequestStarted is called before a request is sent.
+	RequestStarted(host, method string)
+	// RequestFinished is called after a request finished, success or not.
+	RequestFinished(metrics *RequestMetrics)
+}
+
+// RequestMetrics is the metrics of a finished request.
+type RequestMetrics struct {
+	Host   string
+	Method string
+	// StatusCode is zero if the request failed.
+	StatusCode int
+	// StatusClass is like "2xx", "4xx", or "error" if the request failed.
+	StatusClass   string
+	Duration      time.Duration
+	BytesSent     int64
+	BytesReceived int64
+	// Attempt is the number of this attempt, starts from 1. Attempt larger
+	// than 1 means it is a retry. Direwolf sends each request once, so it is
+	// always 1 for now.
+	Attempt int
+	// ErrorKind is the result of ErrorKind, empty if the request succeeded.
+	ErrorKind string
+}
+
+// requestHost returns the host of request url.
+func requestHost(req *Request) string {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// newRequestMetrics build RequestMetrics from requestEvent.
+func newRequestMetrics(e *requestEvent) *RequestMetrics {
+	m := &RequestMetrics{
+		Host:          requestHost(e.request),
+		Method:        e.request.Method,
+		StatusClass:   "error",
+		Duration:      e.duration,
+		BytesSent:     e.bytesSent,
+		BytesReceived: e.bytesReceived,
+		Attempt:       e.attempt,
+		ErrorKind:     ErrorKind(e.err),
+	}
+	if e.response != nil {
+		m.StatusCode = e.response.StatusCode
+		m.StatusClass = strconv.Itoa(e.response.StatusCode/100) + "xx"
+	}
+	return m
+}
+
+// DefaultBuckets is the default buckets of request duration histogram, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a MetricsCollector which exposes the metrics in
+// Prometheus text exposition format. It is also a http.Handler, so it can be
+// mounted to the metrics path of your server:
+//
+//	metrics := direwolf.NewPrometheusMetrics("direwolf")
+//	options := direwolf.DefaultSessionOptions()
+//	options.Metrics = metrics
+//	http.Handle("/metrics", metrics)
+//
+// Every host requested is a value of the host label. When a Session requests
+// many hosts, like a crawler, set HostLabel to limit the number of series.
+type PrometheusMetrics struct {
+	// HostLabel maps the host of request to the value of host label, like
+	// HostAllowlist. The host is used as it is if HostLabel is nil. Set it
+	// before any request is sent.
+	HostLabel func(host string) string
+
+	mu       sync.Mutex
+	families []*metricFamily
+
+	requests      *metricFamily
+	duration      *metricFamily
+	inFlight      *metricFamily
+	bytesSent     *metricFamily
+	bytesReceived *metricFamily
+	retries       *metricFamily
+	errors        *metricFamily
+	buckets       []float64
+}
+
+// NewPrometheusMetrics new a PrometheusMetrics, namespace is the prefix of
+// metric names. Buckets is the buckets of request duration histogram in
+// seconds, DefaultBuckets is used if not passed.
+func NewPrometheusMetrics(namespace string, buckets ...float64) *PrometheusMetrics {
+	if namespace != "" {
+		namespace += "_"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	m := &PrometheusMetrics{buckets: buckets}
+	m.requests = m.newFamily(namespace+"requests_total", "counter",
+		"Total number of requests by host, method and status class.", "host", "method", "status_class")
+	m.duration = m.newFamily(namespace+"request_duration_seconds", "histogram",
+		"Duration of requests in seconds.", "host", "method")
+	m.inFlight = m.newFamily(namespace+"requests_in_flight", "gauge",
+		"Number of requests in flight.", "host", "method")
+	m.bytesSent = m.newFamily(namespace+"request_bytes_sent_total", "counter",
+		"Total bytes of request bodies sent.", "host")
+	m.bytesReceived = m.newFamily(namespace+"response_bytes_received_total", "counter",
+		"Total bytes of response bodies received.", "host")
+	m.retries = m.newFamily(namespace+"request_retries_total", "counter",
+		"Total number of retried requests.", "host", "method")
+	m.errors = m.newFamily(namespace+"request_errors_total", "counter",
+		"Total number of failed requests by error kind.", "host", "method", "kind")
+	return m
+}
+
+// RequestStarted implements MetricsCollector.
+func (m *PrometheusMetrics) RequestStarted(host, method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight.series(m.hostLabel(host), method).value++
+}
+
+// RequestFinished implements MetricsCollector.
+func (m *PrometheusMetrics) RequestFinished(metrics *RequestMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	host, method := m.hostLabel(metrics.Host), metrics.Method
+	m.inFlight.series(host, method).value--
+	m.requests.series(host, method, metrics.StatusClass).value++
+	m.duration.series(host, method).observe(metrics.Duration.Seconds(), m.buckets)
+	m.bytesSent.series(host).value += float64(metrics.BytesSent)
+	m.bytesReceived.series(host).value += float64(metrics.BytesReceived)
+	if metrics.Attempt > 1 {
+		m.retries.series(host, method).value++
+	}
+	if metrics.ErrorKind != "" {
+		m.errors.series(host, method, metrics.ErrorKind).value++
+	}
+}
+
+// hostLabel returns the value of host label of host.
+func (m *PrometheusMetrics) hostLabel(host string) string {
+	if m.HostLabel == nil {
+		return host
+	}
+	return m.HostLabel(host)
+}
+
+// HostAllowlist returns a PrometheusMetrics.HostLabel which keeps the hosts
+// in allowlist, and maps the other hosts to "other".
+func HostAllowlist(hosts ...string) func(host string) string {
+	allowed := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowed[host] = true
+	}
+	return func(host string) string {
+		if allowed[host] {
+			return host
+		}
+		return "other"
+	}
+}
+
+// ServeHTTP implements http.Handler, writes the metrics in Prometheus text
+// exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(m.String()))
+}
+
+// String returns the metrics in Prometheus text exposition format.
+func (m *PrometheusMetrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var buf strings.Builder
+	for _, family := range m.families {
+		family.write(&buf, m.buckets)
+	}
+	return buf.String()
+}
+
+// newFamily new a metricFamily and add it to PrometheusMetrics.
+func (m *PrometheusMetrics) newFamily(name, typ, help string, labelNames ...string) *metricFamily {
+	family := &metricFamily{
+		name:       name,
+		typ:        typ,
+		help:       help,
+		labelNames: labelNames,
+		data:       make(map[string]*metricSeries),
+	}
+	m.families = append(m.families, family)
+	return family
+}
+
+// metricFamily is the metrics with the same name and different label values.
+type metricFamily struct {
+	name       string
+	typ        string
+	help       string
+	labelNames []string
+	data       map[string]*metricSeries
+}
+
+// metricSeries is a metric with specified label values.
+type metricSeries struct {
+	labels  []string
+	value   float64
+	buckets []uint64 // counts of each bucket, for histogram
+	sum     float64
+	count   uint64
+}
+
+// series returns the metricSeries of the label values, new it if not exists.
+func (f *metricFamily) series(labels ...string) *metricSeries {
+	key := strings.Join(labels, "\xff")
+	s, ok := f.data[key]
+	if !ok {
+		s = &metricSeries{labels: labels}
+		f.data[key] = s
+	}
+	return s
+}
+
+// observe adds a value to histogram.
+func (s *metricSeries) observe(value float64, buckets []float64) {
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(buckets))
+	}
+	for i, bound := range buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// write writes the family in Prometheus text exposition format, series are
+// sorted by label values.
+func (f *metricFamily) write(buf *strings.Builder, buckets []float64) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+	keys := make([]string, 0, len(f.data))
+	for key := range f.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.data[key]
+		labels := formatLabels(f.labelNames, s.labels)
+		if f.typ != "histogram" {
+			fmt.Fprintf(buf, "%s%s %s\n", f.name, labels, formatFloat(s.value))
+			continue
+		}
+		names := append(append([]string(nil), f.labelNames...), "le")
+		for i, bound := range buckets {
+			le := formatLabels(names, append(append([]string(nil), s.labels...), formatFloat(bound)))
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, le, s.buckets[i])
+		}
+		le := formatLabels(names, append(append([]string(nil), s.labels...), "+Inf"))
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, le, s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", f.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", f.name, labels, s.count)
+	}
+}
+
+// labelEscaper escapes label values in Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats label names and values like {a="1",b="2"}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat formats float value in Prometheus text format.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
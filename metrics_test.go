@@ -0,0 +1,102 @@
+package direwolf
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(404)
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	metrics := NewPrometheusMetrics("direwolf", 0.5, 0.1)
+	options := DefaultSessionOptions()
+	options.Metrics = metrics
+	session := NewSession(options)
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		if _, err := session.Post(ts.URL+path, Body("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := session.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("request should fail.")
+	}
+
+	metricsServer := httptest.NewServer(metrics)
+	defer metricsServer.Close()
+	resp, err := Get(metricsServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.Headers.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal("PrometheusMetrics content type failed.")
+	}
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	text := resp.Text()
+	for _, line := range []string{
+		"# TYPE direwolf_requests_total counter\n",
+		`direwolf_requests_total{host="` + host + `",method="POST",status_class="2xx"} 2` + "\n",
+		`direwolf_requests_total{host="` + host + `",method="POST",status_class="4xx"} 1` + "\n",
+		`direwolf_requests_total{host="127.0.0.1:1",method="GET",status_class="error"} 1` + "\n",
+		`direwolf_request_errors_total{host="127.0.0.1:1",method="GET",kind="connect"} 1` + "\n",
+		`direwolf_requests_in_flight{host="` + host + `",method="POST"} 0` + "\n",
+		`direwolf_request_bytes_sent_total{host="` + host + `"} 12` + "\n",
+		`direwolf_response_bytes_received_total{host="` + host + `"} 15` + "\n",
+		"# TYPE direwolf_request_retries_total counter\n",
+		"# TYPE direwolf_request_duration_seconds histogram\n",
+		`direwolf_request_duration_seconds_bucket{host="` + host + `",method="POST",le="0.1"} 3` + "\n",
+		`direwolf_request_duration_seconds_bucket{host="` + host + `",method="POST",le="+Inf"} 3` + "\n",
+		`direwolf_request_duration_seconds_count{host="` + host + `",method="POST"} 3` + "\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("metrics should contain %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestPrometheusMetricsHostLabel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	metrics := NewPrometheusMetrics("direwolf")
+	metrics.HostLabel = HostAllowlist(host)
+	options := DefaultSessionOptions()
+	options.Metrics = metrics
+	session := NewSession(options)
+
+	if _, err := session.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Get("http://localhost:" + strconv.Itoa(ts.Listener.Addr().(*net.TCPAddr).Port)); err != nil {
+		t.Fatal(err)
+	}
+	text := metrics.String()
+	for _, line := range []string{
+		`direwolf_requests_total{host="` + host + `",method="GET",status_class="2xx"} 1` + "\n",
+		`direwolf_requests_total{host="other",method="GET",status_class="2xx"} 1` + "\n",
+		`direwolf_requests_in_flight{host="other",method="GET"} 0` + "\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("metrics should contain %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	labels := formatLabels([]string{"a", "b"}, []string{`x"y`, "1\\2\n"})
+	if labels != `{a="x\"y",b="1\\2\n"}` {
+		t.Fatal("formatLabels failed: ", labels)
+	}
+}
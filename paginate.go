@@ -0,0 +1,269 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrPageStrategy is returned when the arguments of a page strategy are invalid.
+var ErrPageStrategy = errors.New("invalid page strategy")
+
+// PageStrategy finds the next page of paginated responses.
+type PageStrategy interface {
+	// NextPage returns the request of next page from the request and
+	// response of current page, or nil if it is the last page.
+	NextPage(req *Request, resp *Response) (*Request, error)
+}
+
+// PageStrategyFunc is a function which implements PageStrategy.
+type PageStrategyFunc func(req *Request, resp *Response) (*Request, error)
+
+// NextPage calls f(req, resp).
+func (f PageStrategyFunc) NextPage(req *Request, resp *Response) (*Request, error) {
+	return f(req, resp)
+}
+
+// Pager iterates the pages of paginated API, it is returned by Paginate.
+// Use it like bufio.Scanner:
+//
+//	pager := direwolf.Paginate(session, req, direwolf.LinkHeaderPages())
+//	for pager.Next(ctx) {
+//		resp := pager.Response()
+//	}
+//	if err := pager.Err(); err != nil {
+//		return err
+//	}
+type Pager struct {
+	// MaxPages is the max number of pages to request, zero means no limit.
+	MaxPages int
+
+	session  *Session
+	strategy PageStrategy
+	next     *Request
+	resp     *Response
+	pages    int
+	err      error
+}
+
+// Paginate returns a Pager which sends req as the first page, and finds the
+// following pages by strategy. The default Session is used if session is nil.
+func Paginate(session *Session, req *Request, strategy PageStrategy) *Pager {
+	if session == nil {
+		session = defaultSession
+	}
+	return &Pager{session: session, strategy: strategy, next: req}
+}
+
+// Next sends the request of next page, it returns false when there is no
+// more page, the MaxPages is reached, or an error occurs. The request is
+// canceled when ctx is done.
+func (pager *Pager) Next(ctx context.Context) bool {
+	if pager.err != nil || pager.next == nil {
+		return false
+	}
+	if pager.MaxPages > 0 && pager.pages >= pager.MaxPages {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		pager.err = err
+		return false
+	}
+
+	req := pager.next
+	resp, err := pager.session.SendContext(ctx, req)
+	if err != nil {
+		pager.err = err
+		return false
+	}
+	pager.resp = resp
+	pager.pages++
+	pager.next, err = pager.strategy.NextPage(req, resp)
+	if err != nil {
+		pager.err = WrapErr(err, "find next page failed")
+	}
+	return true
+}
+
+// Response returns the response of current page.
+func (pager *Pager) Response() *Response {
+	return pager.resp
+}
+
+// Page returns the number of current page, starts from 1.
+func (pager *Pager) Page() int {
+	return pager.pages
+}
+
+// Err returns the error which stops the Pager.
+func (pager *Pager) Err() error {
+	return pager.err
+}
+
+// LinkHeaderPages finds the next page by the Link header with rel="next",
+// as defined by RFC 8288.
+func LinkHeaderPages() PageStrategy {
+	return PageStrategyFunc(func(req *Request, resp *Response) (*Request, error) {
+		for _, header := range resp.Headers.Values("Link") {
+			if link := nextLink(header); link != "" {
+				return requestWithURL(req, resp, link)
+			}
+		}
+		return nil, nil
+	})
+}
+
+// JSONCursorPages finds the cursor of next page in the JSON response by path
+// of JsonGet, and sets it to the query parameter param. It is the last page
+// if the cursor is empty.
+func JSONCursorPages(path, param string) PageStrategy {
+	return PageStrategyFunc(func(req *Request, resp *Response) (*Request, error) {
+		cursor := resp.JsonGet(path)
+		if !cursor.Exists() || cursor.String() == "" {
+			return nil, nil
+		}
+		return requestWithParam(req, param, cursor.String())
+	})
+}
+
+// PageNumberPages increases the page number of query parameter param, which
+// starts from 1. It is the last page if the JSON array at itemsPath of the
+// response is empty.
+func PageNumberPages(param, itemsPath string) PageStrategy {
+	return incrementPages(param, 1, 1, 1, itemsPath)
+}
+
+// OffsetPages increases the offset of query parameter param by limit, which
+// starts from 0. It is the last page if the JSON array at itemsPath of the
+// response has less than limit items. Limit must be positive, otherwise the
+// strategy fails with ErrPageStrategy.
+func OffsetPages(param string, limit int, itemsPath string) PageStrategy {
+	if limit <= 0 { // the offset would never increase
+		return PageStrategyFunc(func(req *Request, resp *Response) (*Request, error) {
+			return nil, WrapErrf(ErrPageStrategy, "OffsetPages limit %d is not positive", limit)
+		})
+	}
+	return incrementPages(param, 0, limit, limit, itemsPath)
+}
+
+// incrementPages increases the query parameter param by step, it is the last
+// page if the items are less than minItems.
+func incrementPages(param string, first, step, minItems int, itemsPath string) PageStrategy {
+	if minItems < 1 {
+		minItems = 1
+	}
+	return PageStrategyFunc(func(req *Request, resp *Response) (*Request, error) {
+		if items := resp.JsonGet(itemsPath).Array(); len(items) < minItems {
+			return nil, nil
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return nil, err
+		}
+		current := first
+		if value := u.Query().Get(param); value != "" {
+			if current, err = strconv.Atoi(value); err != nil {
+				return nil, WrapErrf(err, "invalid page parameter %s", param)
+			}
+		}
+		return requestWithParam(req, param, strconv.Itoa(current+step))
+	})
+}
+
+// CSSNextPages finds the next page by the href of the first node selected by
+// selector in HTML response, like "a.next".
+func CSSNextPages(selector string) PageStrategy {
+	return PageStrategyFunc(func(req *Request, resp *Response) (*Request, error) {
+		href := strings.TrimSpace(resp.CSS(selector).First().Attr("href"))
+		if href == "" {
+			return nil, nil
+		}
+		return requestWithURL(req, resp, href)
+	})
+}
+
+// nextLink returns the target of link with rel="next" in Link header.
+func nextLink(header string) string {
+	for _, link := range splitLinks(header) {
+		link = strings.TrimSpace(link)
+		end := strings.IndexByte(link, '>')
+		if !strings.HasPrefix(link, "<") || end < 0 {
+			continue
+		}
+		target := link[1:end]
+		for _, param := range strings.Split(link[end+1:], ";")[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if !strings.EqualFold(strings.TrimSpace(key), "rel") {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "next") {
+					return target
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// splitLinks splits Link header into links by the commas, which are not in
+// the <> of target or in a quoted string, as defined by RFC 8288.
+func splitLinks(header string) []string {
+	var links []string
+	inTarget, inQuote := false, false
+	start := 0
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case inQuote:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inQuote = false
+			}
+		case c == '<':
+			inTarget = true
+		case c == '>':
+			inTarget = false
+		case c == '"' && !inTarget:
+			inQuote = true
+		case c == ',' && !inTarget:
+			links = append(links, header[start:i])
+			start = i + 1
+		}
+	}
+	return append(links, header[start:])
+}
+
+// requestWithURL returns a copy of req with the link resolved by the URL of
+// resp.
+func requestWithURL(req *Request, resp *Response, link string) (*Request, error) {
+	base, err := url.Parse(resp.URL)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return nil, WrapErrf(err, "invalid next page link %s", link)
+	}
+	next := *req
+	next.URL = base.ResolveReference(ref).String()
+	next.Params = nil
+	return &next, nil
+}
+
+// requestWithParam returns a copy of req with the query parameter set.
+func requestWithParam(req *Request, key, value string) (*Request, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	next := *req
+	next.URL = u.String()
+	next.Params = nil
+	return &next, nil
+}
@@ -0,0 +1,151 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newPagesHandler serves 3 pages of items in different pagination styles.
+func newPagesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/link":
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page < 3 {
+				w.Header().Add("Link", `<https://example.com/first>; rel="first"`)
+				w.Header().Add("Link", fmt.Sprintf(`</link?page=%d>; rel="last next", </link?page=3>; rel=last`, page+1))
+			}
+			_, _ = w.Write([]byte(strconv.Itoa(page)))
+		case "/cursor":
+			next := map[string]string{"": "b", "b": "c", "c": ""}[query.Get("cursor")]
+			_, _ = fmt.Fprintf(w, `{"items": [%q], "meta": {"next": %q}}`, query.Get("cursor"), next)
+		case "/page":
+			page, _ := strconv.Atoi(query.Get("page"))
+			if page > 3 {
+				_, _ = w.Write([]byte(`{"items": []}`))
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"items": [%d]}`, page)
+		case "/offset":
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			items := []int{0, 1, 2, 3, 4}
+			if offset > len(items) {
+				offset = len(items)
+			}
+			end := offset + 2
+			if end > len(items) {
+				end = len(items)
+			}
+			_, _ = fmt.Fprintf(w, `{"items": %s}`, jsonInts(items[offset:end]))
+		case "/html":
+			page, _ := strconv.Atoi(query.Get("p"))
+			if page < 3 {
+				_, _ = fmt.Fprintf(w, `<html><body><a class="next" href="html?p=%d">next</a></body></html>`, page+1)
+				return
+			}
+			_, _ = w.Write([]byte(`<html><body>last</body></html>`))
+		}
+	})
+}
+
+func jsonInts(items []int) string {
+	s := "["
+	for i, item := range items {
+		if i > 0 {
+			s += ","
+		}
+		s += strconv.Itoa(item)
+	}
+	return s + "]"
+}
+
+func TestPaginate(t *testing.T) {
+	ts := httptest.NewServer(newPagesHandler())
+	defer ts.Close()
+
+	tests := []struct {
+		path     string
+		strategy PageStrategy
+		pages    int
+	}{
+		{"/link?page=1", LinkHeaderPages(), 3},
+		{"/cursor", JSONCursorPages("meta.next", "cursor"), 3},
+		{"/page?page=1", PageNumberPages("page", "items"), 4},
+		{"/offset", OffsetPages("offset", 2, "items"), 3},
+		{"/html", CSSNextPages("a.next"), 4},
+	}
+	for _, test := range tests {
+		req, err := NewRequest("GET", ts.URL+test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pager := Paginate(nil, req, test.strategy)
+		for pager.Next(context.Background()) {
+		}
+		if pager.Err() != nil {
+			t.Fatal(pager.Err())
+		}
+		if pager.Page() != test.pages {
+			t.Fatal("Paginate failed: ", test.path, pager.Page(), pager.Response().Text())
+		}
+	}
+}
+
+func TestPaginateLimit(t *testing.T) {
+	ts := httptest.NewServer(newPagesHandler())
+	defer ts.Close()
+
+	req, _ := NewRequest("GET", ts.URL+"/link", NewParams("page", "1"))
+	pager := Paginate(NewSession(), req, LinkHeaderPages())
+	pager.MaxPages = 2
+	var texts []string
+	for pager.Next(context.Background()) {
+		texts = append(texts, pager.Response().Text())
+	}
+	if len(texts) != 2 || texts[0] != "1" || texts[1] != "2" {
+		t.Fatal("MaxPages failed: ", texts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pager = Paginate(nil, req, LinkHeaderPages())
+	if !pager.Next(ctx) {
+		t.Fatal(pager.Err())
+	}
+	cancel()
+	if pager.Next(ctx) || !errors.Is(pager.Err(), context.Canceled) {
+		t.Fatal("Paginate should stop when ctx is canceled: ", pager.Err())
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := map[string]string{
+		`<https://api/x?ids=1,2>; rel="next"`:                                           "https://api/x?ids=1,2",
+		`<https://api/first>; rel=first, <https://api/x?a=1;b=2>; rel=next`:             "https://api/x?a=1;b=2",
+		`<https://api/a>; title="a, <b>"; rel="prev", <https://api/b>; rel="last next"`: "https://api/b",
+		`<https://api/a>; rel="prev"`:                                                   "",
+	}
+	for header, want := range tests {
+		if got := nextLink(header); got != want {
+			t.Fatalf("nextLink(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestOffsetPagesLimit(t *testing.T) {
+	ts := httptest.NewServer(newPagesHandler())
+	defer ts.Close()
+
+	req, _ := NewRequest("GET", ts.URL+"/offset")
+	pager := Paginate(nil, req, OffsetPages("offset", 0, "items"))
+	for pager.Next(context.Background()) {
+	}
+	if !errors.Is(pager.Err(), ErrPageStrategy) || pager.Page() != 1 {
+		t.Fatal("OffsetPages should fail with limit 0: ", pager.Err(), pager.Page())
+	}
+}
@@ -0,0 +1,270 @@
+package direwolf
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrProfileUserAgent is returned when none of SessionOptions.UserAgents
+// matches the browser and platform of SessionOptions.Profile.
+var ErrProfileUserAgent = errors.New("no User-Agent matches the browser profile")
+
+// BrowserProfile is a set of headers and the TLS fingerprint which imitates a
+// browser navigating to a page. Set it to SessionOptions.Profile, then the
+// Session sends the headers of the browser in order instead of the default
+// User-Agent of direwolf, and handshakes TLS with the ClientHello of the
+// browser. The built-in profiles are returned by ProfileChrome and others,
+// each call returns a new copy which can be modified.
+//
+// The ClientHello offers HTTP/2 and HTTP/1.1 by ALPN as the browser does. The
+// headers are only sent in order when the server selects HTTP/1.1, because
+// HTTP/2 of Go can not send headers in order. SessionOptions.DisableHTTP2
+// makes the ClientHello offer HTTP/1.1 only, then it is no longer the same as
+// the browser. Requests with a replaced SessionOptions.Transport are not
+// affected.
+type BrowserProfile struct {
+	Name string
+	// Headers is the headers in the order the browser sends them, each
+	// item is a key and value pair.
+	Headers [][2]string
+	// TLSFingerprint is the ClientHello of the browser, empty means the
+	// one of Go.
+	TLSFingerprint TLSFingerprint
+}
+
+// Header returns the headers of profile as http.Header.
+func (profile *BrowserProfile) Header() http.Header {
+	headers := make(http.Header, len(profile.Headers))
+	for _, pair := range profile.Headers {
+		headers.Add(pair[0], pair[1])
+	}
+	return headers
+}
+
+// UserAgent returns the User-Agent of profile.
+func (profile *BrowserProfile) UserAgent() string {
+	return profile.Header().Get("User-Agent")
+}
+
+// ProfileChrome returns the profile of Chrome on Windows.
+func ProfileChrome() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "chrome",
+		Headers: [][2]string{
+			{"sec-ch-ua", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+			{"sec-ch-ua-mobile", "?0"},
+			{"sec-ch-ua-platform", `"Windows"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Encoding", "gzip, deflate, br, zstd"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+		TLSFingerprint: FingerprintChrome,
+	}
+}
+
+// ProfileChromeAndroid returns the profile of Chrome on Android.
+func ProfileChromeAndroid() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "chrome-android",
+		Headers: [][2]string{
+			{"sec-ch-ua", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+			{"sec-ch-ua-mobile", "?1"},
+			{"sec-ch-ua-platform", `"Android"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Encoding", "gzip, deflate, br, zstd"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+		TLSFingerprint: FingerprintChrome,
+	}
+}
+
+// ProfileFirefox returns the profile of Firefox on Windows.
+func ProfileFirefox() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "firefox",
+		Headers: [][2]string{
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Accept-Encoding", "gzip, deflate, br"},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+		TLSFingerprint: FingerprintFirefox,
+	}
+}
+
+// ProfileFirefoxAndroid returns the profile of Firefox on Android.
+func ProfileFirefoxAndroid() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "firefox-android",
+		Headers: [][2]string{
+			{"User-Agent", "Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Accept-Encoding", "gzip, deflate, br"},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+		TLSFingerprint: FingerprintFirefox,
+	}
+}
+
+// ProfileSafari returns the profile of Safari on macOS.
+func ProfileSafari() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "safari",
+		Headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Encoding", "gzip, deflate, br"},
+		},
+		TLSFingerprint: FingerprintSafari,
+	}
+}
+
+// ProfileSafariIOS returns the profile of Safari on iOS.
+func ProfileSafariIOS() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "safari-ios",
+		Headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Encoding", "gzip, deflate, br"},
+		},
+		TLSFingerprint: FingerprintIOS,
+	}
+}
+
+// UserAgentRotation is the way to select User-Agent from
+// SessionOptions.UserAgents.
+type UserAgentRotation int
+
+const (
+	// UserAgentRandom selects a random User-Agent for each request.
+	UserAgentRandom UserAgentRotation = iota
+	// UserAgentSticky selects a random User-Agent when the Session is
+	// created, and uses it for all requests.
+	UserAgentSticky
+)
+
+// randomUserAgent returns a random User-Agent of the list.
+func randomUserAgent(userAgents []string) string {
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// userAgentBrowsers and userAgentPlatforms are the tokens in User-Agent to
+// tell the browser and platform, the first matched one is used.
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg", "edge"}, {"Firefox/", "firefox"}, {"FxiOS/", "firefox"},
+		{"Chrome/", "chrome"}, {"CriOS/", "chrome"}, {"Safari/", "safari"},
+	}
+	userAgentPlatforms = [][2]string{
+		{"Android", "android"}, {"iPhone", "ios"}, {"iPad", "ios"},
+		{"Windows", "windows"}, {"Macintosh", "macos"}, {"Linux", "linux"},
+	}
+)
+
+// userAgentFamily returns the browser and platform of User-Agent, such as
+// "chrome/windows".
+func userAgentFamily(userAgent string) string {
+	browser, platform := "", ""
+	for _, token := range userAgentBrowsers {
+		if strings.Contains(userAgent, token[0]) {
+			browser = token[1]
+			break
+		}
+	}
+	for _, token := range userAgentPlatforms {
+		if strings.Contains(userAgent, token[0]) {
+			platform = token[1]
+			break
+		}
+	}
+	return browser + "/" + platform
+}
+
+// profileUserAgents returns the User-Agents of the same browser and platform
+// as profile, so that the other headers of profile still fit them.
+func profileUserAgents(profile *BrowserProfile, userAgents []string) ([]string, error) {
+	if profile == nil {
+		return append([]string(nil), userAgents...), nil
+	}
+	family := userAgentFamily(profile.UserAgent())
+	var matched []string
+	for _, userAgent := range userAgents {
+		if userAgentFamily(userAgent) == family {
+			matched = append(matched, userAgent)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, WrapErrf(ErrProfileUserAgent, "profile %s", profile.Name)
+	}
+	return matched, nil
+}
+
+// chromeVersionRegexp matches the major version of Chrome in User-Agent.
+var chromeVersionRegexp = regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)
+
+// brandVersionRegexp matches the versions of Chrome brands in sec-ch-ua.
+var brandVersionRegexp = regexp.MustCompile(`("(?:Chromium|Google Chrome)";v=")\d+"`)
+
+// setUserAgent sets User-Agent to headers, and the version of sec-ch-ua to
+// the version of Chrome in it.
+func setUserAgent(headers http.Header, userAgent string) {
+	headers.Set("User-Agent", userAgent)
+	clientHints := headers.Get("Sec-Ch-Ua")
+	match := chromeVersionRegexp.FindStringSubmatch(userAgent)
+	if clientHints == "" || match == nil {
+		return
+	}
+	headers.Set("Sec-Ch-Ua", brandVersionRegexp.ReplaceAllString(clientHints, `${1}`+match[1]+`"`))
+}
+
+// rotateUserAgent sets a random User-Agent to the request headers, if the
+// Session rotates User-Agent per request and the request has no User-Agent.
+// sec-ch-ua is kept if the request sets it.
+func (session *Session) rotateUserAgent(req *Request, headers http.Header) {
+	if len(session.userAgents) == 0 {
+		return
+	}
+	if _, ok := req.Headers["User-Agent"]; ok {
+		return
+	}
+	userAgent := randomUserAgent(session.userAgents)
+	if _, ok := req.Headers["Sec-Ch-Ua"]; ok {
+		headers.Set("User-Agent", userAgent)
+		return
+	}
+	setUserAgent(headers, userAgent)
+}
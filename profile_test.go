@@ -0,0 +1,139 @@
+package direwolf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newUserAgentServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Sec-Ch-Ua", r.Header.Get("sec-ch-ua"))
+		_, _ = w.Write([]byte(r.UserAgent()))
+	}))
+}
+
+func TestSessionProfile(t *testing.T) {
+	ts := newUserAgentServer()
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.Profile = ProfileChrome()
+	session := NewSession(options)
+	resp, err := session.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != ProfileChrome().UserAgent() || resp.Headers.Get("X-Sec-Ch-Ua") == "" {
+		t.Fatal("Profile headers should be sent: ", resp.Text())
+	}
+
+	for _, profile := range []*BrowserProfile{ProfileChrome(), ProfileChromeAndroid(), ProfileFirefox(),
+		ProfileFirefoxAndroid(), ProfileSafari(), ProfileSafariIOS()} {
+		headers := profile.Header()
+		if headers.Get("User-Agent") == "" || headers.Get("Accept") == "" || headers.Get("Accept-Language") == "" {
+			t.Fatal("Profile should have a coherent header set: ", profile.Name)
+		}
+		if _, err := profile.TLSFingerprint.clientHelloID(); err != nil {
+			t.Fatal("Profile should have a TLS fingerprint: ", profile.Name)
+		}
+	}
+
+	profile := ProfileChrome()
+	profile.Headers[0][1] = "changed"
+	if ProfileChrome().Headers[0][1] == "changed" {
+		t.Fatal("Profile should be returned as a new copy.")
+	}
+}
+
+func TestSessionProfileHeaderOrder(t *testing.T) {
+	URL := newRawHeadServer(t)
+	options := DefaultSessionOptions()
+	options.Profile = ProfileFirefox()
+	resp, err := NewSession(options).Get(URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(resp.Text()), "\r\n")
+	if lines[1] != "User-Agent: "+ProfileFirefox().UserAgent() || !strings.HasPrefix(lines[2], "Accept: ") {
+		t.Fatal("Profile headers should be sent in order: ", lines)
+	}
+}
+
+func TestUserAgentRotation(t *testing.T) {
+	ts := newUserAgentServer()
+	defer ts.Close()
+	userAgents := []string{"agent-1", "agent-2", "agent-3"}
+
+	options := DefaultSessionOptions()
+	options.UserAgents = userAgents
+	session := NewSession(options)
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		resp, err := session.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[resp.Text()] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("User-Agent should be rotated per request: ", seen)
+	}
+	resp, err := session.Get(ts.URL, NewHeaders("User-Agent", "custom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "custom" {
+		t.Fatal("User-Agent of request should not be replaced.")
+	}
+
+	options.UserAgentRotation = UserAgentSticky
+	session = NewSession(options)
+	sticky := session.Headers.Get("User-Agent")
+	for i := 0; i < 10; i++ {
+		resp, err := session.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != sticky {
+			t.Fatal("User-Agent should be sticky in Session.")
+		}
+	}
+}
+
+func TestUserAgentRotationProfile(t *testing.T) {
+	ts := newUserAgentServer()
+	defer ts.Close()
+	chrome120 := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	firefox := ProfileFirefox().UserAgent()
+	chromeMac := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	options := DefaultSessionOptions()
+	options.Profile = ProfileChrome()
+	options.UserAgents = []string{chrome120, firefox, chromeMac}
+	session := NewSession(options)
+	for i := 0; i < 20; i++ {
+		resp, err := session.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Text() != chrome120 {
+			t.Fatal("User-Agent should be rotated within the browser and platform of profile: ", resp.Text())
+		}
+		if !strings.Contains(resp.Headers.Get("X-Sec-Ch-Ua"), `"Google Chrome";v="120"`) {
+			t.Fatal("sec-ch-ua should follow the version of User-Agent: ", resp.Headers.Get("X-Sec-Ch-Ua"))
+		}
+	}
+
+	options.UserAgentRotation = UserAgentSticky
+	session = NewSession(options)
+	if session.Headers.Get("User-Agent") != chrome120 || !strings.Contains(session.Headers.Get("Sec-Ch-Ua"), `v="120"`) {
+		t.Fatal("sticky User-Agent should be selected within profile: ", session.Headers)
+	}
+
+	options.UserAgents = []string{firefox}
+	if NewSession(options) != nil {
+		t.Fatal("NewSession should fail if no User-Agent matches profile.")
+	}
+}
@@ -20,6 +20,37 @@ type Request struct {
 	RedirectNum   int
 	Timeout       int
 	MultipartForm *MultipartForm
+
+	// CompressBody is the content encoding to compress the body.
+	CompressBody string
+
+	// URLTemplate is the url template like "/users/{id}", used by tracing.
+	URLTemplate string
+
+	// InsecureSkipVerify controls whether the request verifies the
+	// server's certificate chain and host name.
+	InsecureSkipVerify bool
+
+	// UnixSocket is the path of unix domain socket to send the request.
+	UnixSocket string
+
+	// HeaderOrder is the order and casing of header keys on the wire, set
+	// by OrderedHeaders. See SessionOptions.PreserveHeaderOrder.
+	HeaderOrder []string
+
+	// UploadLimit and DownloadLimit are the bytes per second to send the
+	// body of request and receive the body of response.
+	UploadLimit   int64
+	DownloadLimit int64
+
+	// UploadProgress and DownloadProgress are called while the bodies are
+	// transferred.
+	UploadProgress   ProgressFunc
+	DownloadProgress ProgressFunc
+
+	// Signer signs the request before it is sent, it replaces the Signer
+	// of Session.
+	Signer Signer
 }
 
 // NewRequest construct a Request by passing the parameters.
@@ -35,10 +66,28 @@ type Request struct {
 // 	direwolf.Proxy: Proxy url to use.
 // 	direwolf.Timeout: Request Timeout.
 // 	direwolf.RedirectNum: Number of Request allowed to redirect.
+// 	direwolf.InsecureSkipVerify: Skip verifying the server certificate.
+// 	direwolf.CompressBody: Content encoding to compress the body.
+// 	direwolf.URLTemplate: URL template for tracing.
+// 	direwolf.UnixSocket: Unix domain socket to send the request.
+// 	direwolf.OrderedHeaders: HTTP Headers to send in order.
+// 	direwolf.RemoveHeaders: Headers of Session not to send.
+// 	direwolf.UploadLimit: Bytes per second to send the body.
+// 	direwolf.DownloadLimit: Bytes per second to receive the body.
+// 	direwolf.UploadProgress: Callback of sending the body.
+// 	direwolf.DownloadProgress: Callback of receiving the body.
+// 	direwolf.SigV4Signer, direwolf.HMACSigner: Signer of the request.
+//
+// The url can be a unix socket url like "http+unix://%2Fvar%2Frun%2Fdocker.sock/info",
+// the host is the url-encoded socket path.
 func NewRequest(method string, URL string, args ...RequestOption) (req *Request, err error) {
 	req = &Request{}                     // new a Request and set default field
 	req.Method = strings.ToUpper(method) // Upper the method string
 	req.URL = URL
+	if socket, httpURL, ok := splitUnixSocketURL(URL); ok {
+		req.URL = httpURL
+		req.UnixSocket = socket
+	}
 
 	// Check the type of the parameter and handle it.
 	for _, arg := range args {
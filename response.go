@@ -22,9 +22,23 @@ type Response struct {
 	Request       *Request
 	Content       []byte
 	ContentLength int64
-	encoding      string
-	text          string
-	dom           *goquery.Document
+
+	// ContentEncoding is the original Content-Encoding header of response.
+	// Content is decompressed if it is gzip, deflate, br or zstd.
+	ContentEncoding string
+	// CompressedSize is the size of the body received, before decompressed.
+	CompressedSize int64
+	// DecompressedSize is the size of Content.
+	DecompressedSize int64
+
+	// Timings is the time spent in each phase of the request.
+	Timings *Timings
+	// ConnInfo is the information about the connection used by the request.
+	ConnInfo *ConnInfo
+
+	encoding string
+	text     string
+	dom      *goquery.Document
 }
 
 // Encoding can change and return the encoding type of response. Like this:
@@ -1,6 +1,8 @@
 package direwolf
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
@@ -16,12 +18,44 @@ import (
 // Session is the main object in direwolf. This is its main features:
 // 1. handling redirects
 // 2. automatically managing cookies
+//
+// Session is safe for concurrent use. Headers, Proxy and Timeout may be set
+// directly before the Session is shared, after that change them by SetHeader,
+// DelHeader, SetProxy and SetTimeout.
 type Session struct {
 	client    *http.Client
 	transport *http.Transport
 	Headers   http.Header
 	Proxy     *Proxy
 	Timeout   int
+
+	// mu guards Headers, HeaderOrder, Proxy and Timeout. They are replaced
+	// instead of modified in place, so a snapshot can be read without lock.
+	mu sync.RWMutex
+
+	// HeaderOrder is the order and casing of the keys of Headers on the
+	// wire. See SessionOptions.PreserveHeaderOrder.
+	HeaderOrder []string
+
+	logger  *requestLogger
+	metrics MetricsCollector
+	tracer  Tracer
+
+	// userAgents is the User-Agents to select randomly for each request.
+	userAgents []string
+
+	// options is the SessionOptions which the Session is built from.
+	options *SessionOptions
+	dialer  *dialer
+
+	// uploadLimiter and downloadLimiter limit the rate of all requests.
+	uploadLimiter   *rateLimiter
+	downloadLimiter *rateLimiter
+
+	// insecure is the client used by requests which skip verifying
+	// the server certificate, it is made when first used.
+	insecure     *http.Client
+	insecureOnce sync.Once
 }
 
 // NewSession new a Session object, and set a default Client and Transport.
@@ -33,55 +67,121 @@ func NewSession(options ...*SessionOptions) *Session {
 		sessionOptions = DefaultSessionOptions()
 	}
 
-	// set transport parameters.
-	trans := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   sessionOptions.DialTimeout,
-			KeepAlive: sessionOptions.DialKeepAlive,
-		}).DialContext,
-		MaxIdleConns:          sessionOptions.MaxIdleConns,
-		MaxIdleConnsPerHost:   sessionOptions.MaxIdleConnsPerHost,
-		MaxConnsPerHost:       sessionOptions.MaxConnsPerHost,
-		IdleConnTimeout:       sessionOptions.IdleConnTimeout,
-		TLSHandshakeTimeout:   sessionOptions.TLSHandshakeTimeout,
-		ExpectContinueTimeout: sessionOptions.ExpectContinueTimeout,
-		Proxy:                 proxyFunc,
+	dialer, err := newDialer(sessionOptions)
+	if err != nil {
+		return nil
 	}
-	if sessionOptions.DisableDialKeepAlives {
-		trans.DisableKeepAlives = true
+	trans, roundTripper, err := newRoundTripper(sessionOptions, dialer)
+	if err != nil {
+		return nil
 	}
-
 	client := &http.Client{
-		Transport:     trans,
+		Transport:     roundTripper,
 		CheckRedirect: redirectFunc,
 	}
-
-	// set CookieJar
 	if sessionOptions.DisableCookieJar == false {
-		cookieJarOptions := cookiejar.Options{
-			PublicSuffixList: publicsuffix.List,
-		}
-		jar, err := cookiejar.New(&cookieJarOptions)
-		if err != nil {
+		if client.Jar, err = newCookieJar(); err != nil {
 			return nil
 		}
-		client.Jar = jar
 	}
 
-	// Set default user agent
+	// Set default user agent, or the headers of browser profile.
 	headers := http.Header{}
 	headers.Add("User-Agent", "direwolf - winter is coming")
+	var order []string
+	if sessionOptions.Profile != nil {
+		headers = sessionOptions.Profile.Header()
+		order = appendHeaderOrder(nil, sessionOptions.Profile.Headers...)
+	}
+
+	session := &Session{
+		client:      client,
+		transport:   trans,
+		Headers:     headers,
+		HeaderOrder: order,
+		logger:      newRequestLogger(sessionOptions),
+		metrics:     sessionOptions.Metrics,
+		tracer:      sessionOptions.Tracer,
+		options:     sessionOptions,
+		dialer:      dialer,
+
+		uploadLimiter:   newRateLimiter(sessionOptions.UploadLimit),
+		downloadLimiter: newRateLimiter(sessionOptions.DownloadLimit),
+	}
+	if len(sessionOptions.UserAgents) > 0 {
+		userAgents, err := profileUserAgents(sessionOptions.Profile, sessionOptions.UserAgents)
+		if err != nil {
+			return nil
+		}
+		if sessionOptions.UserAgentRotation == UserAgentSticky {
+			setUserAgent(headers, randomUserAgent(userAgents))
+		} else {
+			session.userAgents = userAgents
+		}
+	}
+	return session
+}
 
-	return &Session{
-		client:    client,
-		transport: trans,
-		Headers:   headers,
+// newRoundTripper builds the Transport from options, and returns it with the
+// RoundTripper to send requests, which wraps it for h2c, or is replaced by
+// SessionOptions.Transport.
+func newRoundTripper(options *SessionOptions, dialer *dialer) (*http.Transport, http.RoundTripper, error) {
+	// set transport parameters.
+	trans := &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          options.MaxIdleConns,
+		MaxIdleConnsPerHost:   options.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       options.MaxConnsPerHost,
+		IdleConnTimeout:       options.IdleConnTimeout,
+		TLSHandshakeTimeout:   options.TLSHandshakeTimeout,
+		ExpectContinueTimeout: options.ExpectContinueTimeout,
+		Proxy:                 proxyFunc,
+	}
+	if options.DisableDialKeepAlives {
+		trans.DisableKeepAlives = true
+	}
+	// direwolf decompress the content by itself, to support more encodings
+	// even if Accept-Encoding header is set by user.
+	trans.DisableCompression = true
+	if err := configureHTTP2(trans, options); err != nil {
+		return nil, nil, err
 	}
+	var roundTripper http.RoundTripper = trans
+	if options.preserveHeaderOrder() {
+		fingerprint := options.tlsFingerprint()
+		if fingerprint != "" {
+			if _, err := fingerprint.clientHelloID(); err != nil {
+				return nil, nil, err
+			}
+		}
+		configureHeaderOrder(trans, dialer.DialContext)
+		roundTripper = newTunnelTransport(trans, dialer, options)
+	}
+	if options.H2C {
+		roundTripper = newH2CTransport(roundTripper, dialer, options)
+	}
+	if options.Transport != nil { // user specified RoundTripper replaces the default Transport
+		roundTripper = options.Transport
+	}
+	return trans, roundTripper, nil
+}
+
+// newCookieJar new a CookieJar with the public suffix list.
+func newCookieJar() (http.CookieJar, error) {
+	cookieJarOptions := cookiejar.Options{
+		PublicSuffixList: publicsuffix.List,
+	}
+	return cookiejar.New(&cookieJarOptions)
 }
 
 // Send is a generic request method.
 func (session *Session) Send(req *Request) (*Response, error) {
-	resp, err := send(session, req)
+	return session.SendContext(context.Background(), req)
+}
+
+// SendContext is the same as Send, but the request is canceled when ctx is done.
+func (session *Session) SendContext(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := send(ctx, session, req)
 	if err != nil {
 		return nil, WrapErr(err, "session send failed")
 	}
@@ -166,6 +266,75 @@ func (session *Session) Delete(URL string, args ...RequestOption) (*Response, er
 	return resp, nil
 }
 
+// started notifies the observers of Session that a request starts.
+func (session *Session) started(event *requestEvent) {
+	if session.metrics != nil {
+		session.metrics.RequestStarted(requestHost(event.request), event.request.Method)
+	}
+}
+
+// emit sends the event of a finished request to the observers of Session.
+func (session *Session) emit(ctx context.Context, event *requestEvent) {
+	if session.logger != nil {
+		session.logger.log(ctx, event)
+	}
+	if session.metrics != nil {
+		session.metrics.RequestFinished(newRequestMetrics(event))
+	}
+}
+
+// clientFor returns the http.Client to send the request.
+func (session *Session) clientFor(req *Request) *http.Client {
+	if req.InsecureSkipVerify {
+		return session.insecureClient()
+	}
+	return session.client
+}
+
+// insecureClient returns a Client which skips verifying the server certificate.
+// It shares the CookieJar with Session, but uses a clone of the Transport.
+// If the Transport is replaced by SessionOptions.Transport, it is used as is.
+func (session *Session) insecureClient() *http.Client {
+	session.insecureOnce.Do(func() {
+		client := *session.client
+		client.Transport = session.insecureRoundTripper(client.Transport)
+		session.insecure = &client
+	})
+	return session.insecure
+}
+
+// insecureRoundTripper returns a copy of the RoundTripper built by
+// newRoundTripper, whose Transport skips verifying the server certificate.
+// Other RoundTrippers are returned as is.
+func (session *Session) insecureRoundTripper(roundTripper http.RoundTripper) http.RoundTripper {
+	switch trans := roundTripper.(type) {
+	case *http.Transport:
+		return session.insecureTransport(trans)
+	case *tunnelTransport:
+		return newTunnelTransport(session.insecureTransport(trans.direct), trans.dialer, trans.options)
+	case *h2cTransport:
+		return &h2cTransport{h2c: trans.h2c, fallback: session.insecureRoundTripper(trans.fallback)}
+	}
+	return roundTripper
+}
+
+// insecureTransport returns a clone of Transport which skips verifying the
+// server certificate.
+func (session *Session) insecureTransport(trans *http.Transport) *http.Transport {
+	insecureTrans := trans.Clone()
+	if insecureTrans.TLSClientConfig == nil {
+		insecureTrans.TLSClientConfig = &tls.Config{}
+	}
+	insecureTrans.TLSClientConfig.InsecureSkipVerify = true
+	if !session.options.DisableHTTP2 {
+		// The cloned TLSNextProto shares the HTTP/2 connection pool with
+		// the original Transport, configure a new one instead.
+		insecureTrans.TLSNextProto = nil
+		_ = configureHTTP2(insecureTrans, session.options)
+	}
+	return insecureTrans
+}
+
 // Cookies returns the cookies of the given url in Session.
 func (session *Session) Cookies(URL string) Cookies {
 	if session.client.Jar == nil {
@@ -190,6 +359,164 @@ func (session *Session) SetCookies(URL string, cookies Cookies) {
 	session.client.Jar.SetCookies(parsedURL, cookies)
 }
 
+// sessionSnapshot is the headers, proxy and timeout of Session when a
+// request starts, so the request is not affected by the later changes.
+type sessionSnapshot struct {
+	headers     http.Header
+	headerOrder []string
+	proxy       *Proxy
+	timeout     int
+}
+
+// snapshot returns the current headers, proxy and timeout of Session. The
+// headers must not be modified. Session can be nil.
+func (session *Session) snapshot() *sessionSnapshot {
+	if session == nil {
+		return &sessionSnapshot{}
+	}
+	session.mu.RLock()
+	defer session.mu.RUnlock()
+	return &sessionSnapshot{
+		headers:     session.Headers,
+		headerOrder: session.HeaderOrder,
+		proxy:       session.Proxy,
+		timeout:     session.Timeout,
+	}
+}
+
+// SetHeader sets the header of Session, it replaces the existing values of
+// key. It is safe to call while requests are in flight, the requests which
+// have started are not affected.
+func (session *Session) SetHeader(key, value string) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	headers := session.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(key, value)
+	session.Headers = headers
+}
+
+// DelHeader deletes the header of Session. It is safe to call while requests
+// are in flight.
+func (session *Session) DelHeader(key string) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	headers := session.Headers.Clone()
+	headers.Del(key)
+	session.Headers = headers
+}
+
+// SetProxy sets the proxy of Session, nil removes it. The proxy is copied, so
+// changing it later does not affect Session. It is safe to call while
+// requests are in flight.
+func (session *Session) SetProxy(proxy *Proxy) {
+	if proxy != nil {
+		copied := *proxy
+		proxy = &copied
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.Proxy = proxy
+}
+
+// SetTimeout sets the timeout of Session in seconds. It is safe to call
+// while requests are in flight.
+func (session *Session) SetTimeout(timeout int) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.Timeout = timeout
+}
+
+// CloneOptions is the options of Session.Clone.
+type CloneOptions struct {
+	// NewTransport, if true, builds a new Transport from the SessionOptions
+	// of Session, so the clone has its own connection pool. By default the
+	// clone shares the Transport and connection pool with Session. The
+	// SessionOptions.Transport is always shared.
+	NewTransport bool
+
+	// ShareCookieJar, if true, the clone shares the CookieJar with Session.
+	// By default the clone has a new empty CookieJar.
+	ShareCookieJar bool
+
+	// Headers are set to the copied headers of Session, they replace the
+	// values of the same keys.
+	Headers http.Header
+
+	// Proxy and Timeout, if set, replace the Proxy and Timeout of Session.
+	Proxy   *Proxy
+	Timeout int
+}
+
+// Clone returns a new Session derived from session, such as a Session of a
+// tenant. The headers, proxy and timeout are copied, so the changes of the
+// clone do not affect session. The logger, metrics, tracer and the limits
+// of SessionOptions are shared. It returns an error if the new Transport or
+// CookieJar can not be built.
+func (session *Session) Clone(options ...*CloneOptions) (*Session, error) {
+	opts := &CloneOptions{}
+	if len(options) > 0 && options[0] != nil {
+		opts = options[0]
+	}
+
+	client := &http.Client{
+		Transport:     session.client.Transport,
+		CheckRedirect: session.client.CheckRedirect,
+		Jar:           session.client.Jar,
+	}
+	trans := session.transport
+	if opts.NewTransport {
+		var err error
+		if trans, client.Transport, err = newRoundTripper(session.options, session.dialer); err != nil {
+			return nil, WrapErr(err, "clone Session failed")
+		}
+	}
+	if !opts.ShareCookieJar && client.Jar != nil {
+		var err error
+		if client.Jar, err = newCookieJar(); err != nil {
+			return nil, WrapErr(err, "clone Session failed")
+		}
+	}
+
+	snapshot := session.snapshot()
+	clone := &Session{
+		client:      client,
+		transport:   trans,
+		Headers:     snapshot.headers.Clone(),
+		HeaderOrder: append([]string(nil), snapshot.headerOrder...),
+		Timeout:     snapshot.timeout,
+		logger:      session.logger,
+		metrics:     session.metrics,
+		tracer:      session.tracer,
+		userAgents:  session.userAgents,
+		options:     session.options,
+		dialer:      session.dialer,
+
+		uploadLimiter:   session.uploadLimiter,
+		downloadLimiter: session.downloadLimiter,
+	}
+	if clone.Headers == nil {
+		clone.Headers = http.Header{}
+	}
+	if snapshot.proxy != nil {
+		proxy := *snapshot.proxy
+		clone.Proxy = &proxy
+	}
+	for key, values := range opts.Headers {
+		clone.Headers[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	if opts.Proxy != nil { // copied, so the later changes of caller do not race with requests
+		proxy := *opts.Proxy
+		clone.Proxy = &proxy
+	}
+	if opts.Timeout > 0 {
+		clone.Timeout = opts.Timeout
+	}
+	return clone, nil
+}
+
 type SessionOptions struct {
 	// DialTimeout is the maximum amount of time a dial will wait for
 	// a connect to complete.
@@ -254,6 +581,159 @@ type SessionOptions struct {
 	//
 	// This is unrelated to the similarly named TCP keep-alives.
 	DisableDialKeepAlives bool
+
+	// Transport, if non-nil, replaces the http.Transport built from the
+	// options above. All requests of the Session are sent through it,
+	// so it can be used to inject a mock RoundTripper in unit tests.
+	//
+	// The dial, idle connection and TLS options above have no effect
+	// when Transport is set.
+	Transport http.RoundTripper
+
+	// Logger, if non-nil, receives one event for each request sent by
+	// the Session. *slog.Logger can be used directly.
+	Logger Logger
+
+	// LogVerbosity controls whether headers and bodies are logged.
+	LogVerbosity LogVerbosity
+
+	// LogRedactHeaders is the headers whose values are replaced by "***"
+	// in log. Authorization, Cookie and Set-Cookie are always redacted.
+	LogRedactHeaders []string
+
+	// LogRedactParams is the query parameters whose values are replaced
+	// by "***" in log.
+	LogRedactParams []string
+
+	// Metrics, if non-nil, collects the metrics of requests sent by the
+	// Session. Use NewPrometheusMetrics to expose them to Prometheus.
+	Metrics MetricsCollector
+
+	// Tracer, if non-nil, creates a client span for each request sent by
+	// the Session, and injects W3C traceparent and tracestate headers.
+	Tracer Tracer
+
+	// DisableHTTP2, if true, disables HTTP/2, all requests are sent by
+	// HTTP/1.1. By default HTTP/2 is used for https requests if the server
+	// supports it. With Profile, the TLS fingerprint then only offers
+	// HTTP/1.1 by ALPN, which differs from the browser.
+	DisableHTTP2 bool
+
+	// HTTP2ReadIdleTimeout is the timeout after which a health check using
+	// ping frame will be carried out if no frame is received on the HTTP/2
+	// connection. Zero means no health check.
+	HTTP2ReadIdleTimeout time.Duration
+
+	// HTTP2PingTimeout is the timeout after which the HTTP/2 connection will
+	// be closed if a response to ping is not received. Defaults to 15s.
+	HTTP2PingTimeout time.Duration
+
+	// HTTP2MaxHeaderListSize is the http2 SETTINGS_MAX_HEADER_LIST_SIZE sent
+	// to servers. Zero means the default limit of 10MB.
+	HTTP2MaxHeaderListSize uint32
+
+	// Dialer, if non-nil, is used to dial TCP connections instead of the
+	// one built from DialTimeout and DialKeepAlive.
+	Dialer *net.Dialer
+
+	// DialContext, if non-nil, replaces the TCP dial function, such as
+	// dialing by a SOCKS proxy, then Dialer and LocalAddr have no effect.
+	// Unix sockets are always dialed by direwolf.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// LocalAddr is the local ip address, or the name of network interface
+	// like "eth0", which the connections are bound to.
+	LocalAddr string
+
+	// ForceIPv4, if true, connects only by IPv4 addresses. It can not be
+	// set with ForceIPv6, NewSession returns nil for the conflict.
+	ForceIPv4 bool
+
+	// ForceIPv6, if true, connects only by IPv6 addresses.
+	ForceIPv6 bool
+
+	// HostOverrides pins the host names to ips, like the --resolve of curl.
+	// The key is a host like "example.com", or a host and port like
+	// "example.com:443", the value is the ip to connect.
+	HostOverrides map[string]string
+
+	// DNSServer is the address of dns server like "8.8.8.8:53" which is used
+	// to resolve host names, port 53 is used if not specified.
+	DNSServer string
+
+	// Resolver, if non-nil, is used to resolve host names. It takes
+	// precedence over DNSServer.
+	Resolver *net.Resolver
+
+	// DNSCacheTTL, if positive, caches the resolved ips of host names in the
+	// Session for the duration.
+	DNSCacheTTL time.Duration
+
+	// Profile, if non-nil, sets the headers of a browser to Session.Headers,
+	// such as ProfileChrome(), instead of the default User-Agent. The
+	// headers are sent in the order of profile as PreserveHeaderOrder does,
+	// and https requests are handshaked with the TLS fingerprint of profile,
+	// see BrowserProfile.
+	Profile *BrowserProfile
+
+	// UserAgents is a list of User-Agents to rotate. By UserAgentRotation,
+	// a random one is selected for each request, or for the whole Session.
+	// User-Agent set in request is not replaced. If Profile is set, only the
+	// User-Agents of the same browser and platform as profile are used, and
+	// the version of sec-ch-ua follows the selected one.
+	UserAgents []string
+
+	// UserAgentRotation is the way to select User-Agent from UserAgents.
+	UserAgentRotation UserAgentRotation
+
+	// PreserveHeaderOrder, if true, sends the headers in the order and casing
+	// of Request.HeaderOrder and Session.HeaderOrder, which are set by
+	// OrderedHeaders and Profile. Headers not in order are sent after them.
+	// HTTP/2 lowercases and reorders headers, so the headers are only in
+	// order over HTTP/1.1, https requests to the servers which select HTTP/2
+	// are not affected. Set DisableHTTP2 to send all requests by HTTP/1.1.
+	// It is always on if Profile is set.
+	PreserveHeaderOrder bool
+
+	// H2C, if true, sends http requests by cleartext HTTP/2 with prior
+	// knowledge, the server must support h2c. It is usually used for
+	// internal services. Proxy is not supported for h2c requests, and
+	// https requests are not affected.
+	H2C bool
+
+	// UploadLimit, if positive, limits the bytes per second to send the
+	// bodies of all requests of the Session. Request can set a lower limit
+	// by UploadLimit option. The timeout of request is not extended, set a
+	// longer Timeout for large bodies.
+	UploadLimit int64
+
+	// DownloadLimit, if positive, limits the bytes per second to receive
+	// the bodies of all responses of the Session, including the streams
+	// of SSE. Request can set a lower limit by DownloadLimit option.
+	DownloadLimit int64
+
+	// Signer, if non-nil, signs all requests of the Session, such as
+	// SigV4Signer and HMACSigner. Request can replace it by passing its
+	// own Signer.
+	Signer Signer
+
+	// MaxDecompressedSize limits the bytes of response body decompressed by
+	// Content-Encoding, so that a small compression bomb can not exhaust the
+	// memory. Zero means the default 256MB, negative means no limit.
+	MaxDecompressedSize int64
+}
+
+// preserveHeaderOrder returns whether the headers are sent in order.
+func (options *SessionOptions) preserveHeaderOrder() bool {
+	return options.PreserveHeaderOrder || options.Profile != nil
+}
+
+// tlsFingerprint returns the TLS fingerprint of Profile, empty if not set.
+func (options *SessionOptions) tlsFingerprint() TLSFingerprint {
+	if options.Profile == nil {
+		return ""
+	}
+	return options.Profile.TLSFingerprint
 }
 
 // DefaultSessionOptions return a default SessionOptions object.
@@ -284,6 +764,11 @@ func proxyFunc(req *http.Request) (*url.URL, error) {
 	httpURLStr := req.Context().Value("http")   // get http proxy url form context
 	httpsURLStr := req.Context().Value("https") // get https proxy url form context
 
+	// Request sent to unix socket does not use proxy.
+	if _, ok := req.Context().Value(unixSocketKey{}).(string); ok {
+		return nil, nil
+	}
+
 	// If there is no proxy set, use default proxy from environment.
 	// This mitigates expensive lookups on some platforms (e.g. Windows).
 	envProxyOnce.Do(func() {
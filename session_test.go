@@ -1,8 +1,10 @@
 package direwolf
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -288,3 +290,169 @@ func TestSessionCookies(t *testing.T) {
 		t.Fatal("Session.Cookies() failed.")
 	}
 }
+
+func TestSessionClone(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/setCookie" {
+			http.SetCookie(w, &http.Cookie{Name: "key", Value: "value"})
+		}
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+		w.Header().Set("X-Cookie", r.Header.Get("Cookie"))
+		_, _ = w.Write([]byte(r.Header.Get("X-Tenant")))
+	}))
+	defer ts.Close()
+
+	session := NewSession()
+	session.Headers.Set("X-Tenant", "parent")
+	parentResp, err := session.Get(ts.URL + "/setCookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &Proxy{HTTPS: "http://127.0.0.1:1"} // not used by http requests
+	clone, err := session.Clone(&CloneOptions{Headers: http.Header{"x-tenant": {"child"}}, Proxy: proxy, Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.HTTPS = "http://127.0.0.1:2"
+	if clone.Proxy == proxy || clone.Proxy.HTTPS != "http://127.0.0.1:1" {
+		t.Fatal("Session.Clone should copy the proxy of CloneOptions: ", clone.Proxy)
+	}
+	clone.Headers.Set("X-Only-Child", "1")
+	resp, err := clone.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text() != "child" || resp.Headers.Get("X-Cookie") != "" || clone.Timeout != 5 {
+		t.Fatal("Session.Clone should override headers and use a new CookieJar: ", resp.Text(), resp.Headers)
+	}
+	if resp.Headers.Get("X-Remote-Addr") != parentResp.Headers.Get("X-Remote-Addr") {
+		t.Fatal("Session.Clone should share the connection pool.")
+	}
+	if session.Headers.Get("X-Tenant") != "parent" || session.Headers.Get("X-Only-Child") != "" {
+		t.Fatal("Session.Clone should copy the headers: ", session.Headers)
+	}
+
+	shared, err := session.Clone(&CloneOptions{NewTransport: true, ShareCookieJar: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = shared.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers.Get("X-Cookie") != "key=value" {
+		t.Fatal("Session.Clone should share the CookieJar: ", resp.Headers)
+	}
+	if resp.Headers.Get("X-Remote-Addr") == parentResp.Headers.Get("X-Remote-Addr") {
+		t.Fatal("Session.Clone should use a new connection pool.")
+	}
+}
+
+func TestSessionCloneConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Tenant")))
+	}))
+	defer ts.Close()
+
+	session := NewSession()
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		clone, err := session.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tenant := strconv.Itoa(i)
+		go func() {
+			for j := 0; j < 10; j++ {
+				clone.Headers.Set("X-Tenant", tenant)
+				resp, err := clone.Get(ts.URL)
+				if err == nil && resp.Text() != tenant {
+					err = errors.New("wrong tenant: " + resp.Text())
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := session.Get(ts.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSessionSetHeaderConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-Version")))
+	}))
+	defer ts.Close()
+
+	session := NewSession()
+	session.SetHeader("X-Version", "0")
+	stop := make(chan struct{})
+	changed := make(chan struct{})
+	go func() {
+		defer close(changed)
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			session.SetHeader("X-Version", strconv.Itoa(i))
+			session.DelHeader("X-Removed")
+			session.SetTimeout(i%5 + 5)
+			if i%2 == 0 {
+				session.SetProxy(&Proxy{HTTP: ts.URL}) // the test server also serves as proxy.
+			} else {
+				session.SetProxy(nil)
+			}
+		}
+	}()
+
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 20; j++ {
+				resp, err := session.Get(ts.URL)
+				if err == nil {
+					if _, convErr := strconv.Atoi(resp.Text()); convErr != nil {
+						err = errors.New("inconsistent header: " + resp.Text())
+					}
+				}
+				if err == nil {
+					req, _ := NewRequest("GET", ts.URL)
+					_, err = req.Dump(&DumpOptions{Session: session})
+				}
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	<-changed
+
+	session.SetProxy(nil)
+	session.DelHeader("X-Version")
+	resp, err := session.Get(ts.URL)
+	if err != nil || resp.Text() != "" {
+		t.Fatal("Session.DelHeader failed: ", resp, err)
+	}
+}
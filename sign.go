@@ -0,0 +1,347 @@
+package direwolf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer signs the request before it is sent. It is called after the params
+// are appended to URL, the headers of Session are merged and the body is set,
+// so the signature matches what is sent. Set it by SessionOptions.Signer, or
+// pass it in the args of request.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is a function which implements Signer, it can be passed in the
+// args of request.
+type SignerFunc func(req *http.Request) error
+
+// Sign calls f(req).
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// RequestOption interface method, bind request and option.
+func (f SignerFunc) bindRequest(request *Request) error {
+	request.Signer = f
+	return nil
+}
+
+// signRequest signs httpReq by the signer of request, or the signer of
+// session if request has no signer. Session can be nil.
+func signRequest(httpReq *http.Request, session *Session, req *Request) error {
+	signer := req.Signer
+	if signer == nil && session != nil && session.options != nil {
+		signer = session.options.Signer
+	}
+	if signer == nil {
+		return nil
+	}
+	if err := signer.Sign(httpReq); err != nil {
+		return WrapErr(err, "sign request failed")
+	}
+	return nil
+}
+
+// emptyPayloadHash is the sha256 of empty body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// payloadHash returns the hex sha256 of request body, the body is read from
+// GetBody, so it is not consumed. It returns empty string if the body can not
+// be read again, such as the MultipartForm with io.Reader parts.
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptyPayloadHash, nil
+	}
+	if req.GetBody == nil {
+		return "", nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SigV4Signer signs the request by AWS Signature Version 4, it is used by
+// AWS and the S3 compatible stores like MinIO.
+type SigV4Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the token of temporary credentials, optional.
+	SessionToken string
+	Region       string
+	// Service is the signing name of service, like "s3" or "execute-api".
+	Service string
+
+	// UnsignedPayload, if true, does not hash the body, it is supported by
+	// S3. The body which can not be read again is always unsigned.
+	UnsignedPayload bool
+
+	now func() time.Time
+}
+
+// RequestOption interface method, bind request and option.
+func (signer *SigV4Signer) bindRequest(request *Request) error {
+	request.Signer = signer
+	return nil
+}
+
+// sigV4IgnoredHeaders are not signed, because they may be changed by proxies.
+var sigV4IgnoredHeaders = map[string]bool{
+	"Authorization":     true,
+	"User-Agent":        true,
+	"X-Amzn-Trace-Id":   true,
+	"Expect":            true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+}
+
+// Sign signs the request, and sets the Authorization, X-Amz-Date and
+// X-Amz-Content-Sha256 headers.
+func (signer *SigV4Signer) Sign(req *http.Request) error {
+	now := time.Now
+	if signer.now != nil {
+		now = signer.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	scope := t.Format("20060102") + "/" + signer.Region + "/" + signer.Service + "/aws4_request"
+
+	hash := "UNSIGNED-PAYLOAD"
+	if !signer.UnsignedPayload {
+		h, err := payloadHash(req)
+		if err != nil {
+			return err
+		}
+		if h != "" {
+			hash = h
+		}
+	}
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if signer.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", signer.SessionToken)
+	}
+	if signer.Service == "s3" || hash == "UNSIGNED-PAYLOAD" {
+		req.Header.Set("X-Amz-Content-Sha256", hash)
+	}
+
+	headers, signedHeaders := sigV4Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL, signer.Service != "s3"),
+		sigV4Query(req.URL),
+		headers,
+		signedHeaders,
+		hash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSum(sha256.New, []byte("AWS4"+signer.SecretAccessKey), t.Format("20060102"))
+	for _, s := range []string{signer.Region, signer.Service, "aws4_request"} {
+		key = hmacSum(sha256.New, key, s)
+	}
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+signer.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+// sigV4Headers returns the canonical headers and signed headers of request.
+func sigV4Headers(req *http.Request) (string, string) {
+	values := map[string]string{}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values["host"] = host
+	for key, vs := range req.Header {
+		if sigV4IgnoredHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[strings.ToLower(key)] = strings.Join(trimmed, ",")
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var headers strings.Builder
+	for _, key := range keys {
+		headers.WriteString(key + ":" + values[key] + "\n")
+	}
+	return headers.String(), strings.Join(keys, ";")
+}
+
+// sigV4Path returns the canonical URI, which is encoded twice for the
+// services other than S3.
+func sigV4Path(u *url.URL, doubleEncode bool) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	path = sigV4Escape(path, false)
+	if doubleEncode {
+		path = sigV4Escape(path, false)
+	}
+	return path
+}
+
+// sigV4Query returns the canonical query string, sorted by encoded keys, then
+// by encoded values. Sorting the joined "key=value" would put "a.b=2" before
+// "a=1", because '.' sorts before '='.
+func sigV4Query(u *url.URL) string {
+	query := u.Query()
+	pairs := make([][2]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{sigV4Escape(key, true), sigV4Escape(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	joined := make([]string, len(pairs))
+	for i, pair := range pairs {
+		joined[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(joined, "&")
+}
+
+// sigV4Escape encodes s by RFC 3986 as AWS requires, the slash is encoded
+// only if encodeSlash is true.
+func sigV4Escape(s string, encodeSlash bool) string {
+	const hexChars = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexChars[c>>4])
+		b.WriteByte(hexChars[c&15])
+	}
+	return b.String()
+}
+
+// hmacSum returns the HMAC of data with key.
+func hmacSum(h func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// HMACSigner signs the request by HMAC of a canonical string, which is used
+// by many partner APIs. By default, the canonical string is:
+//
+//	METHOD\nREQUEST_URI\nTIMESTAMP\nHEX_SHA256_OF_BODY
+//
+// and the hex signature is set to X-Signature header.
+type HMACSigner struct {
+	Key []byte
+
+	// Hash is the hash function of HMAC, default is sha256.New.
+	Hash func() hash.Hash
+
+	// Header is the header of signature, default is X-Signature.
+	Header string
+
+	// Prefix is prepended to the signature in header, like "HMAC key-id:".
+	Prefix string
+
+	// Base64, if true, encodes the signature by base64 instead of hex.
+	Base64 bool
+
+	// TimestampHeader, if not empty, is set to the unix timestamp before
+	// signing, default is X-Timestamp. Set it to "-" to disable.
+	TimestampHeader string
+
+	// CanonicalString builds the string to sign from the request and the
+	// hex sha256 of body, which is empty if the body can not be read again.
+	// The headers of request are merged before it is called.
+	CanonicalString func(req *http.Request, bodyHash string) string
+
+	now func() time.Time
+}
+
+// RequestOption interface method, bind request and option.
+func (signer *HMACSigner) bindRequest(request *Request) error {
+	request.Signer = signer
+	return nil
+}
+
+// Sign sets the timestamp and the signature headers of request.
+func (signer *HMACSigner) Sign(req *http.Request) error {
+	timestampHeader := signer.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = "X-Timestamp"
+	}
+	if timestampHeader != "-" {
+		now := time.Now
+		if signer.now != nil {
+			now = signer.now
+		}
+		req.Header.Set(timestampHeader, strconv.FormatInt(now().Unix(), 10))
+	}
+
+	bodyHash, err := payloadHash(req)
+	if err != nil {
+		return err
+	}
+	var canonical string
+	if signer.CanonicalString != nil {
+		canonical = signer.CanonicalString(req, bodyHash)
+	} else {
+		canonical = strings.Join([]string{
+			req.Method,
+			req.URL.RequestURI(),
+			req.Header.Get(timestampHeader),
+			bodyHash,
+		}, "\n")
+	}
+
+	h := signer.Hash
+	if h == nil {
+		h = sha256.New
+	}
+	sum := hmacSum(h, signer.Key, canonical)
+	signature := hex.EncodeToString(sum)
+	if signer.Base64 {
+		signature = base64.StdEncoding.EncodeToString(sum)
+	}
+	header := signer.Header
+	if header == "" {
+		header = "X-Signature"
+	}
+	req.Header.Set(header, signer.Prefix+signature)
+	return nil
+}
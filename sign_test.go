@@ -0,0 +1,153 @@
+package direwolf
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fixedTime() time.Time {
+	return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+}
+
+func newTestSigV4Signer() *SigV4Signer {
+	return &SigV4Signer{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+		now:             fixedTime,
+	}
+}
+
+// TestSigV4Signer checks the signer by the AWS Signature Version 4 test suite.
+func TestSigV4Signer(t *testing.T) {
+	tests := map[string]string{
+		"https://example.amazonaws.com/":                             "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		"https://example.amazonaws.com/?Param2=value2&Param1=value1": "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		// A key is the prefix of another, the canonical query is a=1&a.b=2&page=y&page2=x.
+		"https://example.amazonaws.com/?page2=x&a.b=2&page=y&a=1": "f61c16b51db0210a6b746c80f00f8ef5ead286e2b4bbf5ec2aaadb64908ba761",
+	}
+	for URL, signature := range tests {
+		req, err := http.NewRequest("GET", URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := newTestSigV4Signer().Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+			"SignedHeaders=host;x-amz-date, Signature=" + signature
+		if req.Header.Get("Authorization") != want {
+			t.Fatal("SigV4Signer failed: ", req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestSigV4Query(t *testing.T) {
+	u, _ := url.Parse("https://example.com/?filter.name=x&filter=y&b=2&b=1&a%20b=1")
+	if query := sigV4Query(u); query != "a%20b=1&b=1&b=2&filter=y&filter.name=x" {
+		t.Fatal("sigV4Query should sort by keys, then by values: ", query)
+	}
+}
+
+// signedHeaders returns the SignedHeaders in Authorization of SigV4.
+func signedHeaders(authorization string) []string {
+	i := strings.Index(authorization, "SignedHeaders=")
+	if i < 0 {
+		return nil
+	}
+	value := authorization[i+len("SignedHeaders="):]
+	return strings.Split(value[:strings.Index(value, ",")], ";")
+}
+
+func TestSessionSigV4Signer(t *testing.T) {
+	signer := newTestSigV4Signer()
+	signer.Service = "s3"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// sign the received request again with the signed headers.
+		body, _ := io.ReadAll(r.Body)
+		req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+		for _, key := range signedHeaders(r.Header.Get("Authorization")) {
+			if key != "host" {
+				req.Header[http.CanonicalHeaderKey(key)] = r.Header.Values(key)
+			}
+		}
+		verifier := *signer
+		verifier.UnsignedPayload = r.Header.Get("X-Amz-Content-Sha256") == "UNSIGNED-PAYLOAD"
+		if err := verifier.Sign(req); err != nil {
+			t.Error(err)
+		}
+		if req.Header.Get("Authorization") != r.Header.Get("Authorization") {
+			w.WriteHeader(403)
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.Signer = signer
+	session := NewSession(options)
+	session.Headers.Set("X-Amz-Meta-Owner", "direwolf")
+	resp, err := session.Put(ts.URL+"/bucket/a b.txt", NewParams("x-id", "PutObject"), Body("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || !strings.Contains(resp.Text(), "x-amz-meta-owner") {
+		t.Fatal("SigV4Signer of Session failed: ", resp.StatusCode, resp.Text())
+	}
+
+	// The streaming body which can not be read again is unsigned.
+	mf := NewMultipartForm()
+	_ = mf.WriteReader("file", strings.NewReader("content"), 7, &PartOptions{FileName: "a.txt"})
+	resp, err = session.Post(ts.URL, mf)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatal("SigV4Signer with unsigned payload failed: ", resp, err)
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	key := []byte("secret")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodyHash := sha256.Sum256(body)
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + r.Header.Get("X-Timestamp") + "\n" + hex.EncodeToString(bodyHash[:])))
+		if r.Header.Get("X-Signature") != "v1="+hex.EncodeToString(mac.Sum(nil)) || r.Header.Get("X-Timestamp") != "1440938160" {
+			w.WriteHeader(403)
+		}
+	}))
+	defer ts.Close()
+
+	signer := &HMACSigner{Key: key, Prefix: "v1=", now: fixedTime}
+	resp, err := Post(ts.URL+"/orders", NewParams("id", "1"), NewJsonBody(jsonUser{ID: 2}), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatal("HMACSigner failed: ", resp.StatusCode)
+	}
+
+	custom := &HMACSigner{
+		Key:             key,
+		Header:          "Authorization",
+		TimestampHeader: "-",
+		Base64:          true,
+		CanonicalString: func(req *http.Request, bodyHash string) string { return req.URL.Path },
+	}
+	req, _ := http.NewRequest("GET", "https://example.com/path", nil)
+	if err := custom.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Authorization") != "J01HP8V0pBL/O8tXG5nicw2ALQMBauy1EI6sG/TeE64=" || req.Header.Get("X-Timestamp") != "" {
+		t.Fatal("HMACSigner with custom canonical string failed: ", req.Header)
+	}
+}
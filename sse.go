@@ -0,0 +1,345 @@
+package direwolf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrEventStream is returned when the response is not a valid event stream.
+var ErrEventStream = errors.New("invalid event stream")
+
+// Event is an event of Server-Sent Events.
+type Event struct {
+	// ID is the last event id of the stream when the event is dispatched.
+	ID string
+	// Event is the event type, default is "message".
+	Event string
+	Data  string
+	// Retry is the reconnection time sent by server with the event, zero
+	// if not sent.
+	Retry time.Duration
+}
+
+// SSEOptions is the options of Session.SSE, pass it in the args of SSE.
+type SSEOptions struct {
+	// RetryDelay is the delay before reconnecting, the server can change it
+	// by the retry field. Default is 3s.
+	RetryDelay time.Duration
+
+	// MaxRetryDelay limits the delay when backing off after failed
+	// reconnections. Default is 1min.
+	MaxRetryDelay time.Duration
+
+	// MaxRetries is the max number of consecutive failed reconnections,
+	// zero means no limit.
+	MaxRetries int
+
+	// MaxLineSize limits the bytes of a line of the stream, the stream stops
+	// with ErrEventStream if a line is longer. Default is 1MB.
+	MaxLineSize int
+}
+
+// DefaultSSEOptions return a default SSEOptions object.
+func DefaultSSEOptions() *SSEOptions {
+	return &SSEOptions{
+		RetryDelay:    3 * time.Second,
+		MaxRetryDelay: time.Minute,
+		MaxRetries:    0,
+		MaxLineSize:   1 << 20,
+	}
+}
+
+// RequestOption interface method. SSEOptions is used by Session.SSE, it does
+// not change the request.
+func (options *SSEOptions) bindRequest(request *Request) error {
+	return nil
+}
+
+// EventStream is the stream of events returned by Session.SSE. It reconnects
+// automatically with Last-Event-ID header when the connection is lost.
+type EventStream struct {
+	session *Session
+	req     *Request
+	options *SSEOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	events  chan *Event
+
+	lastID        string
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+// SSE connects to the Server-Sent Events endpoint, and returns the stream of
+// events. The request is built from URL and args like Get, so the headers,
+// cookies and proxy of Session are used. Pass *SSEOptions in args to change
+// the reconnection behavior.
+//
+// The stream stops when ctx is done or Close is called, when the server
+// responds 204 No Content, or when the reconnection fails.
+func (session *Session) SSE(ctx context.Context, URL string, args ...RequestOption) (*EventStream, error) {
+	req, err := NewRequest("GET", URL, args...)
+	if err != nil {
+		return nil, err
+	}
+	options := DefaultSSEOptions()
+	for _, arg := range args {
+		if o, ok := arg.(*SSEOptions); ok {
+			options = o
+		}
+	}
+	if req.Headers == nil {
+		req.Headers = http.Header{}
+	}
+	if req.Headers.Get("Accept") == "" {
+		req.Headers.Set("Accept", "text/event-stream")
+	}
+	req.Headers.Set("Cache-Control", "no-cache")
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &EventStream{
+		session:       session,
+		req:           req,
+		options:       options,
+		ctx:           ctx,
+		cancel:        cancel,
+		events:        make(chan *Event),
+		retryDelay:    options.RetryDelay,
+		maxRetryDelay: options.MaxRetryDelay,
+	}
+	if stream.retryDelay <= 0 {
+		stream.retryDelay = 3 * time.Second
+	}
+	if stream.maxRetryDelay <= 0 {
+		stream.maxRetryDelay = time.Minute
+	}
+
+	body, err := stream.connect()
+	if err != nil {
+		cancel()
+		return nil, WrapErr(err, "connect event stream failed")
+	}
+	go stream.run(body)
+	return stream, nil
+}
+
+// Events returns the channel of events, it is closed when the stream stops.
+func (stream *EventStream) Events() <-chan *Event {
+	return stream.events
+}
+
+// Err returns the error which stops the stream, after the channel of events
+// is closed. It is nil if the stream is stopped by ctx or Close.
+func (stream *EventStream) Err() error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	return stream.err
+}
+
+// Close stops the stream and closes the connection.
+func (stream *EventStream) Close() {
+	stream.cancel()
+}
+
+// connect sends the request with Last-Event-ID, and checks the response.
+func (stream *EventStream) connect() (io.ReadCloser, error) {
+	req := *stream.req
+	req.Headers = stream.req.Headers.Clone()
+	if stream.lastID != "" {
+		req.Headers.Set("Last-Event-ID", stream.lastID)
+	}
+	resp, cancel, err := openStream(stream.ctx, stream.session, &req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		cancel()
+		if resp.StatusCode == http.StatusNoContent {
+			return nil, nil
+		}
+		return nil, WrapErrf(ErrEventStream, "status code %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, WrapErrf(ErrEventStream, "content type %s", resp.Header.Get("Content-Type"))
+	}
+	return &streamBody{ReadCloser: resp.Body, cancel: cancel}, nil
+}
+
+// run reads the events, and reconnects until the stream stops.
+func (stream *EventStream) run(body io.ReadCloser) {
+	defer close(stream.events)
+	defer stream.cancel()
+	failures := 0
+	for body != nil {
+		err := stream.read(body)
+		_ = body.Close()
+		if stream.ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return
+		}
+		if errors.Is(err, ErrEventStream) { // reconnecting would fail the same way
+			stream.mu.Lock()
+			stream.err = WrapErr(err, "read event stream failed")
+			stream.mu.Unlock()
+			return
+		}
+
+		// reconnect with backoff until connected
+		for {
+			delay := stream.retryDelay << uint(failures)
+			if delay > stream.maxRetryDelay || delay <= 0 {
+				delay = stream.maxRetryDelay
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-stream.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			body, err = stream.connect()
+			if err == nil {
+				failures = 0
+				break
+			}
+			if stream.ctx.Err() != nil {
+				return
+			}
+			failures++
+			if errors.Is(err, ErrEventStream) ||
+				(stream.options.MaxRetries > 0 && failures >= stream.options.MaxRetries) {
+				stream.mu.Lock()
+				stream.err = WrapErr(err, "reconnect event stream failed")
+				stream.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// read parses the events of body, and sends them to the channel, as defined
+// by https://html.spec.whatwg.org/multipage/server-sent-events.html.
+func (stream *EventStream) read(body io.Reader) error {
+	maxLineSize := stream.options.MaxLineSize
+	if maxLineSize <= 0 {
+		maxLineSize = 1 << 20
+	}
+	bufSize := 4096
+	if bufSize > maxLineSize { // the scanner allows tokens as large as the buffer
+		bufSize = maxLineSize
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, bufSize), maxLineSize)
+	scanner.Split(scanEventLines)
+
+	var data strings.Builder
+	var eventType string
+	var retry time.Duration
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Text()
+		if first { // the stream may start with a BOM, which is ignored
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" { // dispatch the event
+			if data.Len() > 0 {
+				event := &Event{
+					ID:    stream.lastID,
+					Event: eventType,
+					Data:  strings.TrimSuffix(data.String(), "\n"),
+					Retry: retry,
+				}
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				select {
+				case stream.events <- event:
+				case <-stream.ctx.Done():
+					return stream.ctx.Err()
+				}
+			}
+			data.Reset()
+			eventType = ""
+			retry = 0
+			continue
+		}
+		if strings.HasPrefix(line, ":") { // comment
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				stream.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				retry = time.Duration(ms) * time.Millisecond
+				stream.retryDelay = retry
+			}
+		}
+	}
+	if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+		return WrapErrf(ErrEventStream, "line longer than %d bytes", maxLineSize)
+	}
+	return scanner.Err()
+}
+
+// scanEventLines is a bufio.SplitFunc which splits lines by CRLF, LF or CR.
+func scanEventLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF { // need more data to check CRLF
+				return 0, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// streamBody cancels the request context when the body is closed.
+type streamBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the request context.
+func (body *streamBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
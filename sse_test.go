@@ -0,0 +1,128 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionSSE(t *testing.T) {
+	var connections int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&connections, 1) {
+		case 1:
+			if r.Header.Get("Accept") != "text/event-stream" || r.Header.Get("Token") != "secret" {
+				w.WriteHeader(400)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte(": comment\nretry: 10\r\nid: 1\ndata: hello\ndata: world\n\nevent: update\rid: 2\rdata:{}\r\r"))
+		case 2:
+			if r.Header.Get("Last-Event-ID") != "2" {
+				w.WriteHeader(400)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("\ufeffdata: again\n\ndata: partial")) // BOM is ignored
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	session := NewSession()
+	session.Headers.Set("Token", "secret")
+	stream, err := session.SSE(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*Event
+	for event := range stream.Events() {
+		events = append(events, event)
+	}
+	if stream.Err() != nil {
+		t.Fatal(stream.Err())
+	}
+	if len(events) != 3 {
+		t.Fatal("SSE should receive 3 events: ", len(events))
+	}
+	if events[0].ID != "1" || events[0].Event != "message" || events[0].Data != "hello\nworld" || events[0].Retry != 10*time.Millisecond {
+		t.Fatal("SSE first event failed: ", events[0])
+	}
+	if events[1].ID != "2" || events[1].Event != "update" || events[1].Data != "{}" {
+		t.Fatal("SSE second event failed: ", events[1])
+	}
+	if events[2].ID != "2" || events[2].Data != "again" {
+		t.Fatal("SSE should reconnect with Last-Event-ID: ", events[2])
+	}
+}
+
+func TestSessionSSECancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := NewSession().SSE(ctx, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-stream.Events(); event.Data != "first" {
+		t.Fatal("SSE first event failed: ", event)
+	}
+	cancel()
+	select {
+	case _, ok := <-stream.Events():
+		if ok {
+			t.Fatal("SSE should stop after ctx canceled.")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("SSE should stop after ctx canceled.")
+	}
+}
+
+func TestSessionSSEFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not events"))
+	}))
+	defer ts.Close()
+
+	_, err := NewSession().SSE(context.Background(), ts.URL, &SSEOptions{MaxRetries: 1})
+	if !errors.Is(err, ErrEventStream) {
+		t.Fatal("SSE should fail with wrong content type: ", err)
+	}
+}
+
+func TestSessionSSELineTooLong(t *testing.T) {
+	var connections int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&connections, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: short\n\ndata: " + strings.Repeat("x", 64) + "\n\n"))
+	}))
+	defer ts.Close()
+
+	stream, err := NewSession().SSE(context.Background(), ts.URL, &SSEOptions{RetryDelay: time.Millisecond, MaxLineSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []*Event
+	for event := range stream.Events() {
+		events = append(events, event)
+	}
+	if !errors.Is(stream.Err(), ErrEventStream) || len(events) != 1 {
+		t.Fatal("SSE should stop with a line longer than MaxLineSize: ", stream.Err(), len(events))
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Fatal("SSE should not reconnect after a line is too long: ", n)
+	}
+}
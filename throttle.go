@@ -0,0 +1,220 @@
+package direwolf
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// UploadLimit limits the bytes per second to send the body of request. It
+// works together with SessionOptions.UploadLimit.
+type UploadLimit int64
+
+// RequestOption interface method, bind request and option.
+func (options UploadLimit) bindRequest(request *Request) error {
+	request.UploadLimit = int64(options)
+	return nil
+}
+
+// DownloadLimit limits the bytes per second to receive the body of response.
+// It works together with SessionOptions.DownloadLimit.
+type DownloadLimit int64
+
+// RequestOption interface method, bind request and option.
+func (options DownloadLimit) bindRequest(request *Request) error {
+	request.DownloadLimit = int64(options)
+	return nil
+}
+
+// ProgressFunc is called with the bytes transferred and the total bytes of
+// a body, total is -1 if it is unknown.
+type ProgressFunc func(transferred, total int64)
+
+// UploadProgress is called while the body of request is sent, with the bytes
+// sent and the length of body, which is -1 if unknown. It is called again
+// from zero if the body is sent again by redirect.
+type UploadProgress ProgressFunc
+
+// RequestOption interface method, bind request and option.
+func (options UploadProgress) bindRequest(request *Request) error {
+	request.UploadProgress = ProgressFunc(options)
+	return nil
+}
+
+// DownloadProgress is called while the body of response is received, with
+// the bytes received and the Content-Length of response, which is -1 if
+// unknown. The bytes are counted before decompressed.
+type DownloadProgress ProgressFunc
+
+// RequestOption interface method, bind request and option.
+func (options DownloadProgress) bindRequest(request *Request) error {
+	request.DownloadProgress = ProgressFunc(options)
+	return nil
+}
+
+// throttleRequest returns a shallow copy of httpReq whose body is limited by
+// the upload limits of session and request, and reports the progress. The
+// httpReq is returned if there is nothing to do.
+func throttleRequest(httpReq *http.Request, session *Session, req *Request) *http.Request {
+	if httpReq.Body == nil || httpReq.Body == http.NoBody {
+		return httpReq
+	}
+	limiters := rateLimiters(session.uploadLimiter, req.UploadLimit)
+	if len(limiters) == 0 && req.UploadProgress == nil {
+		return httpReq
+	}
+	total := httpReq.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	wrap := func(body io.ReadCloser) io.ReadCloser {
+		return &throttledBody{
+			body:     body,
+			ctx:      httpReq.Context(),
+			limiters: limiters,
+			progress: req.UploadProgress,
+			total:    total,
+		}
+	}
+
+	throttled := httpReq.WithContext(httpReq.Context())
+	throttled.Body = wrap(httpReq.Body)
+	if httpReq.GetBody != nil {
+		throttled.GetBody = func() (io.ReadCloser, error) {
+			body, err := httpReq.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return wrap(body), nil
+		}
+	}
+	return throttled
+}
+
+// throttleResponse limits the body of resp by the download limits of session
+// and request, and reports the progress.
+func throttleResponse(ctx context.Context, resp *http.Response, session *Session, req *Request) {
+	limiters := rateLimiters(session.downloadLimiter, req.DownloadLimit)
+	if len(limiters) == 0 && req.DownloadProgress == nil {
+		return
+	}
+	resp.Body = &throttledBody{
+		body:     resp.Body,
+		ctx:      ctx,
+		limiters: limiters,
+		progress: req.DownloadProgress,
+		total:    resp.ContentLength,
+	}
+}
+
+// rateLimiters returns the limiter of session and a new limiter of request
+// limit, if they are set.
+func rateLimiters(sessionLimiter *rateLimiter, requestLimit int64) []*rateLimiter {
+	var limiters []*rateLimiter
+	if sessionLimiter != nil {
+		limiters = append(limiters, sessionLimiter)
+	}
+	if limiter := newRateLimiter(requestLimit); limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	return limiters
+}
+
+// throttledBody waits for the limiters after each read, and reports the
+// progress.
+type throttledBody struct {
+	body        io.ReadCloser
+	ctx         context.Context
+	limiters    []*rateLimiter
+	progress    ProgressFunc
+	transferred int64
+	total       int64
+}
+
+func (body *throttledBody) Read(p []byte) (int, error) {
+	for _, limiter := range body.limiters {
+		if len(p) > limiter.burst {
+			p = p[:limiter.burst]
+		}
+	}
+	n, err := body.body.Read(p)
+	if n > 0 {
+		var waitErr error
+		for _, limiter := range body.limiters {
+			if waitErr = limiter.wait(body.ctx, n); waitErr != nil {
+				break
+			}
+		}
+		body.transferred += int64(n)
+		if body.progress != nil {
+			body.progress(body.transferred, body.total)
+		}
+		if waitErr != nil { // the n bytes are read, return them with the error
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (body *throttledBody) Close() error {
+	return body.body.Close()
+}
+
+// rateLimiter is a token bucket of bytes, which is shared by the bodies of
+// requests, so it limits their total rate.
+type rateLimiter struct {
+	rate  float64 // bytes per second
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter new a rateLimiter of bytesPerSecond, it returns nil if
+// bytesPerSecond is not positive. The burst is the bytes of 100ms.
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := int(bytesPerSecond / 10)
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes n tokens from the bucket, and blocks until the tokens are
+// available or ctx is done. The tokens can be taken in advance, then the
+// following callers wait longer, so that they are served in order.
+func (limiter *rateLimiter) wait(ctx context.Context, n int) error {
+	limiter.mu.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > float64(limiter.burst) {
+		limiter.tokens = float64(limiter.burst)
+	}
+	limiter.last = now
+	limiter.tokens -= float64(n)
+	delay := time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+	limiter.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
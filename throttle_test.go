@@ -0,0 +1,142 @@
+package direwolf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEchoBodyHandler responds the body of request, or the bytes of size in
+// query if the request has no body.
+func newEchoBodyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if size, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+			body = bytes.Repeat([]byte("d"), size)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write(body)
+	})
+}
+
+func TestUploadLimit(t *testing.T) {
+	ts := httptest.NewServer(newEchoBodyHandler())
+	defer ts.Close()
+
+	var sent, total int64
+	start := time.Now()
+	resp, err := Post(ts.URL, Body(strings.Repeat("u", 20000)), UploadLimit(50000),
+		UploadProgress(func(n, size int64) { sent, total = n, size }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 5000 bytes of burst are sent at once, then 15000 bytes take 300ms.
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatal("UploadLimit failed: ", elapsed)
+	}
+	if len(resp.Content) != 20000 || sent != 20000 || total != 20000 {
+		t.Fatal("UploadProgress failed: ", len(resp.Content), sent, total)
+	}
+
+	// MultipartForm is limited by Session.
+	options := DefaultSessionOptions()
+	options.UploadLimit = 50000
+	session := NewSession(options)
+	mf := NewMultipartForm()
+	_ = mf.WriteReader("file", strings.NewReader(strings.Repeat("m", 20000)), -1, &PartOptions{FileName: "m"})
+	start = time.Now()
+	if _, err := session.Post(ts.URL, mf); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatal("Session UploadLimit failed: ", elapsed)
+	}
+}
+
+func TestDownloadLimit(t *testing.T) {
+	ts := httptest.NewServer(newEchoBodyHandler())
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.DownloadLimit = 50000
+	session := NewSession(options)
+	var received, total int64
+	start := time.Now()
+	resp, err := session.Get(ts.URL, NewParams("size", "20000"),
+		DownloadProgress(func(n, size int64) { received, total = n, size }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatal("DownloadLimit failed: ", elapsed)
+	}
+	if len(resp.Content) != 20000 || received != 20000 || total != 20000 {
+		t.Fatal("DownloadProgress failed: ", len(resp.Content), received, total)
+	}
+
+	// The request limit is lower than the limit of Session.
+	start = time.Now()
+	if _, err := session.Get(ts.URL, NewParams("size", "10000"), DownloadLimit(20000)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatal("request DownloadLimit failed: ", elapsed)
+	}
+}
+
+func TestDownloadLimitStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: " + strings.Repeat("s", 10000) + "\n\n"))
+	}))
+	defer ts.Close()
+
+	options := DefaultSessionOptions()
+	options.DownloadLimit = 20000
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	stream, err := NewSession(options).SSE(ctx, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-stream.Events(); len(event.Data) != 10000 {
+		t.Fatal("SSE event failed: ", len(event.Data))
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatal("DownloadLimit of stream failed: ", elapsed)
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiter := newRateLimiter(10)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter.wait(ctx, 100); err != context.DeadlineExceeded {
+		t.Fatal("wait should return when ctx is done: ", err)
+	}
+}
+
+func TestThrottledBodyCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body := &throttledBody{
+		body:     io.NopCloser(strings.NewReader("hello")),
+		ctx:      ctx,
+		limiters: []*rateLimiter{newRateLimiter(10)},
+	}
+	p := make([]byte, 5)
+	if n, err := body.Read(p); n != 1 || err != nil { // the burst is not waited for
+		t.Fatal("throttledBody read failed: ", n, err)
+	}
+	n, err := body.Read(p)
+	if n != 1 || string(p[:n]) != "e" || err != context.Canceled {
+		t.Fatal("throttledBody should return the bytes read with the error: ", n, err)
+	}
+}
@@ -0,0 +1,149 @@
+package direwolf
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is the time points and durations of each phase of a request.
+// If the request is redirected, it records the last request. Time points of
+// the phases not happened are zero, such as DNS and connect of a reused
+// connection.
+type Timings struct {
+	Start             time.Time
+	DNSStart          time.Time
+	DNSDone           time.Time
+	ConnectStart      time.Time
+	ConnectDone       time.Time
+	TLSHandshakeStart time.Time
+	TLSHandshakeDone  time.Time
+	GotConn           time.Time
+	WroteRequest      time.Time
+	FirstByte         time.Time
+	Done              time.Time
+
+	// DNSLookup is the duration of resolving host name.
+	DNSLookup time.Duration
+	// TCPConnect is the duration of establishing TCP connection.
+	TCPConnect time.Duration
+	// TLSHandshake is the duration of TLS handshake.
+	TLSHandshake time.Duration
+	// ServerProcessing is the duration from request written to first
+	// response byte received.
+	ServerProcessing time.Duration
+	// TimeToFirstByte is the duration from start to first response byte received.
+	TimeToFirstByte time.Duration
+	// ContentTransfer is the duration of downloading response body.
+	ContentTransfer time.Duration
+	// Total is the duration of the whole request.
+	Total time.Duration
+}
+
+// ConnInfo is the information about the connection used by a request.
+type ConnInfo struct {
+	// Reused is whether this connection has been previously used for
+	// another HTTP request.
+	Reused bool
+	// WasIdle is whether this connection was obtained from an idle pool.
+	WasIdle bool
+	// IdleTime is how long the connection was previously idle, if WasIdle is true.
+	IdleTime time.Duration
+	// RemoteAddr is the remote address the request was sent to, like "1.2.3.4:443".
+	// It is the address of proxy if a proxy is used.
+	RemoteAddr string
+	// LocalAddr is the local address of the connection.
+	LocalAddr string
+}
+
+// requestTracer records the timings and connection info by httptrace.
+type requestTracer struct {
+	mu       sync.Mutex
+	timings  Timings
+	connInfo ConnInfo
+}
+
+// newRequestTracer new a requestTracer, and returns a context with the
+// ClientTrace attached.
+func newRequestTracer(ctx context.Context) (*requestTracer, context.Context) {
+	tracer := &requestTracer{}
+	tracer.timings.Start = time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { tracer.record(&tracer.timings.DNSStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { tracer.record(&tracer.timings.DNSDone) },
+		ConnectStart: func(network, addr string) {
+			tracer.mu.Lock()
+			defer tracer.mu.Unlock()
+			if tracer.timings.ConnectStart.IsZero() || !tracer.timings.ConnectDone.IsZero() {
+				tracer.timings.ConnectStart = time.Now() // keep the first of parallel dials
+				tracer.timings.ConnectDone = time.Time{}
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				tracer.record(&tracer.timings.ConnectDone)
+			}
+		},
+		TLSHandshakeStart: func() { tracer.record(&tracer.timings.TLSHandshakeStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tracer.record(&tracer.timings.TLSHandshakeDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tracer.mu.Lock()
+			defer tracer.mu.Unlock()
+			tracer.timings.GotConn = time.Now()
+			tracer.connInfo = ConnInfo{
+				Reused:   info.Reused,
+				WasIdle:  info.WasIdle,
+				IdleTime: info.IdleTime,
+			}
+			if info.Conn != nil {
+				tracer.connInfo.RemoteAddr = info.Conn.RemoteAddr().String()
+				tracer.connInfo.LocalAddr = info.Conn.LocalAddr().String()
+			}
+			if info.Reused { // clear the phases of previous request when redirect.
+				tracer.timings.DNSStart, tracer.timings.DNSDone = time.Time{}, time.Time{}
+				tracer.timings.ConnectStart, tracer.timings.ConnectDone = time.Time{}, time.Time{}
+				tracer.timings.TLSHandshakeStart, tracer.timings.TLSHandshakeDone = time.Time{}, time.Time{}
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { tracer.record(&tracer.timings.WroteRequest) },
+		GotFirstResponseByte: func() { tracer.record(&tracer.timings.FirstByte) },
+	}
+	return tracer, httptrace.WithClientTrace(ctx, trace)
+}
+
+// record set the time point to now.
+func (tracer *requestTracer) record(point *time.Time) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	*point = time.Now()
+}
+
+// finish records the done time, and returns the timings and connection info.
+func (tracer *requestTracer) finish() (*Timings, *ConnInfo) {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	t := tracer.timings
+	t.Done = time.Now()
+	t.DNSLookup = between(t.DNSStart, t.DNSDone)
+	t.TCPConnect = between(t.ConnectStart, t.ConnectDone)
+	t.TLSHandshake = between(t.TLSHandshakeStart, t.TLSHandshakeDone)
+	t.ServerProcessing = between(t.WroteRequest, t.FirstByte)
+	t.TimeToFirstByte = between(t.Start, t.FirstByte)
+	t.ContentTransfer = between(t.FirstByte, t.Done)
+	t.Total = t.Done.Sub(t.Start)
+	connInfo := tracer.connInfo
+	return &t, &connInfo
+}
+
+// between returns the duration between two time points, or zero if any of
+// them is not recorded.
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,47 @@
+package direwolf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseTimings(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(200)
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	}))
+	defer ts.Close()
+
+	session := NewSession()
+	resp, err := session.Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timings := resp.Timings
+	if timings.TCPConnect <= 0 || timings.TLSHandshake <= 0 {
+		t.Fatal("Timings should record connect and TLS handshake.")
+	}
+	if timings.ServerProcessing < 50*time.Millisecond || timings.ContentTransfer < 20*time.Millisecond {
+		t.Fatal("Timings should record server processing and content transfer: ", timings.ServerProcessing, timings.ContentTransfer)
+	}
+	if timings.Total < timings.TimeToFirstByte+timings.ContentTransfer-time.Millisecond {
+		t.Fatal("Timings total is less than phases.")
+	}
+	if resp.ConnInfo.Reused || !strings.HasPrefix(resp.ConnInfo.RemoteAddr, "127.0.0.1:") {
+		t.Fatal("ConnInfo of new connection failed: ", resp.ConnInfo)
+	}
+
+	resp, err = session.Get(ts.URL, InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.ConnInfo.Reused || !resp.ConnInfo.WasIdle || resp.Timings.TCPConnect != 0 {
+		t.Fatal("ConnInfo of reused connection failed: ", resp.ConnInfo)
+	}
+}
@@ -0,0 +1,268 @@
+package direwolf
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTraceparent is returned when the traceparent header is invalid.
+var ErrTraceparent = errors.New("invalid traceparent")
+
+// Tracer creates the client spans of requests. It has the same shape as the
+// tracer of OpenTelemetry, so it is easy to adapt. NewSimpleTracer is a
+// built-in implementation.
+type Tracer interface {
+	// Start creates a span and a context containing it. The span should be
+	// the child of the span in ctx, if there is one.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span created by Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	SetStatus(code SpanStatus, description string)
+	// SpanContext returns the identity of the span, which is injected into
+	// traceparent and tracestate headers.
+	SpanContext() SpanContext
+	End()
+}
+
+// SpanStatus is the status code of a span.
+type SpanStatus int
+
+// The status codes of span, the same as OpenTelemetry.
+const (
+	SpanStatusUnset SpanStatus = iota
+	SpanStatusError
+	SpanStatusOK
+)
+
+// SpanContext is the identity of a span, as defined by W3C Trace Context.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid check whether the trace id and span id are not all zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns the traceparent header value of the span context.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parse the traceparent and tracestate headers, such as the
+// headers of an incoming request, into a SpanContext. Put it into context by
+// ContextWithSpanContext, then the span of request is linked to it.
+func ParseTraceparent(traceparent, tracestate string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, WrapErrf(ErrTraceparent, "traceparent: %s", traceparent)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, WrapErrf(ErrTraceparent, "traceparent: %s", traceparent)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, WrapErrf(ErrTraceparent, "traceparent: %s", traceparent)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, WrapErrf(ErrTraceparent, "traceparent: %s", traceparent)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, WrapErrf(ErrTraceparent, "traceparent: %s", traceparent)
+	}
+	if !sc.IsValid() {
+		return sc, WrapErrf(ErrTraceparent, "traceparent: %s", traceparent)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.TraceState = strings.TrimSpace(tracestate)
+	return sc, nil
+}
+
+// spanContextKey is the context key of SpanContext.
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a context with the SpanContext as the parent
+// of spans created by SimpleTracer.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the SpanContext in ctx, or an invalid one.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// URLTemplate is the template of request url with low cardinality, such as
+// "/users/{id}". It is used as the span name and url.template attribute.
+type URLTemplate string
+
+// RequestOption interface method, bind request option to request.
+func (options URLTemplate) bindRequest(request *Request) error {
+	request.URLTemplate = string(options)
+	return nil
+}
+
+// startSpan starts the client span of request if Session has a Tracer.
+// It returns a nil span if tracing is disabled.
+func (session *Session) startSpan(ctx context.Context, req *Request, event *requestEvent) (context.Context, Span) {
+	if session.tracer == nil {
+		return ctx, nil
+	}
+	name := req.Method
+	if req.URLTemplate != "" {
+		name += " " + req.URLTemplate
+	}
+	ctx, span := session.tracer.Start(ctx, name)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", redactURLUserinfo(req.URL))
+	span.SetAttribute("server.address", requestHost(req))
+	// Direwolf sends each request once, so the first attempt has resent 0 times.
+	span.SetAttribute("http.request.resend_count", event.attempt-1)
+	if req.URLTemplate != "" {
+		span.SetAttribute("url.template", req.URLTemplate)
+	}
+	return ctx, span
+}
+
+// injectSpan sets traceparent and tracestate headers of the span.
+func injectSpan(header http.Header, span Span) {
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+	header.Set("Traceparent", sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set("Tracestate", sc.TraceState)
+	} else {
+		header.Del("Tracestate")
+	}
+}
+
+// endSpan records the result of request and ends the span.
+func endSpan(span Span, e *requestEvent) {
+	if e.response != nil {
+		span.SetAttribute("http.response.status_code", e.response.StatusCode)
+		if e.response.StatusCode >= 400 {
+			span.SetStatus(SpanStatusError, http.StatusText(e.response.StatusCode))
+		}
+	}
+	if e.err != nil {
+		span.SetAttribute("error.type", ErrorKind(e.err))
+		span.RecordError(e.err)
+		span.SetStatus(SpanStatusError, e.err.Error())
+	} else if e.response != nil && e.response.StatusCode < 400 {
+		span.SetStatus(SpanStatusOK, "")
+	}
+	span.End()
+}
+
+// redactURLUserinfo removes the password in url.
+func redactURLUserinfo(rawURL string) string {
+	return maskURL(&DumpOptions{MaskSecrets: true}, rawURL)
+}
+
+// SimpleTracer is a built-in Tracer which generates W3C trace context, and
+// reports the ended spans to a callback.
+type SimpleTracer struct {
+	onEnd func(span *RecordedSpan)
+}
+
+// NewSimpleTracer new a SimpleTracer, onEnd is called with every ended span.
+func NewSimpleTracer(onEnd func(span *RecordedSpan)) *SimpleTracer {
+	return &SimpleTracer{onEnd: onEnd}
+}
+
+// Start implements Tracer. The new span is the child of the SpanContext in
+// ctx, or the root of a new trace.
+func (tracer *SimpleTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	span := &RecordedSpan{
+		Name:       name,
+		Parent:     parent,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		onEnd:      tracer.onEnd,
+	}
+	span.Context.Sampled = true
+	if parent.IsValid() {
+		span.Context.TraceID = parent.TraceID
+		span.Context.Sampled = parent.Sampled
+		span.Context.TraceState = parent.TraceState
+	} else {
+		_, _ = rand.Read(span.Context.TraceID[:])
+	}
+	_, _ = rand.Read(span.Context.SpanID[:])
+	return ContextWithSpanContext(ctx, span.Context), span
+}
+
+// RecordedSpan is the span created by SimpleTracer.
+type RecordedSpan struct {
+	mu                sync.Mutex
+	Name              string
+	Context           SpanContext
+	Parent            SpanContext
+	StartTime         time.Time
+	EndTime           time.Time
+	Attributes        map[string]interface{}
+	Errors            []error
+	Status            SpanStatus
+	StatusDescription string
+	onEnd             func(span *RecordedSpan)
+}
+
+// SetAttribute implements Span.
+func (span *RecordedSpan) SetAttribute(key string, value interface{}) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.Attributes[key] = value
+}
+
+// RecordError implements Span.
+func (span *RecordedSpan) RecordError(err error) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.Errors = append(span.Errors, err)
+}
+
+// SetStatus implements Span.
+func (span *RecordedSpan) SetStatus(code SpanStatus, description string) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.Status = code
+	span.StatusDescription = description
+}
+
+// SpanContext implements Span.
+func (span *RecordedSpan) SpanContext() SpanContext {
+	return span.Context
+}
+
+// End implements Span.
+func (span *RecordedSpan) End() {
+	span.mu.Lock()
+	span.EndTime = time.Now()
+	span.mu.Unlock()
+	if span.onEnd != nil {
+		span.onEnd(span)
+	}
+}
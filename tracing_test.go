@@ -0,0 +1,98 @@
+package direwolf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSessionTracer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Traceparent", r.Header.Get("Traceparent"))
+		w.Header().Set("X-Tracestate", r.Header.Get("Tracestate"))
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(503)
+		}
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var spans []*RecordedSpan
+	options := DefaultSessionOptions()
+	options.Tracer = NewSimpleTracer(func(span *RecordedSpan) {
+		mu.Lock()
+		defer mu.Unlock()
+		spans = append(spans, span)
+	})
+	session := NewSession(options)
+
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithSpanContext(context.Background(), parent)
+	req, err := NewRequest("GET", ts.URL+"/users/1", URLTemplate("/users/{id}"), NewHeaders("Tracestate", "stale"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := session.SendContext(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := spans[0]
+	if span.Name != "GET /users/{id}" || span.Parent != parent || span.Context.TraceID != parent.TraceID {
+		t.Fatal("span should be the child of parent in context.")
+	}
+	if resp.Headers.Get("X-Traceparent") != span.Context.Traceparent() || resp.Headers.Get("X-Tracestate") != "vendor=value" {
+		t.Fatal("traceparent and tracestate should be injected: ", resp.Headers)
+	}
+	if span.Attributes["http.request.method"] != "GET" || span.Attributes["url.template"] != "/users/{id}" ||
+		span.Attributes["http.response.status_code"] != 503 || span.Attributes["http.request.resend_count"] != 0 ||
+		span.Status != SpanStatusError {
+		t.Fatal("span attributes failed: ", span.Attributes)
+	}
+
+	// Request without parent starts a new trace.
+	if _, err := session.Get("http://127.0.0.1:1"); err == nil {
+		t.Fatal("request should fail.")
+	}
+	span = spans[1]
+	if span.Parent.IsValid() || !span.Context.IsValid() || span.Context.TraceID == parent.TraceID {
+		t.Fatal("span without parent should start a new trace.")
+	}
+	if len(span.Errors) != 1 || span.Attributes["error.type"] != ErrorKindConnect {
+		t.Fatal("span should record error.")
+	}
+
+	if _, err := session.Get(ts.URL + "/ok"); err != nil {
+		t.Fatal(err)
+	}
+	if span = spans[2]; span.Status != SpanStatusOK {
+		t.Fatal("span of succeeded request should have OK status: ", span.Status)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Sampled || sc.Traceparent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00" {
+		t.Fatal("ParseTraceparent failed.")
+	}
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid, ""); !errors.Is(err, ErrTraceparent) {
+			t.Fatal("ParseTraceparent should fail: ", invalid)
+		}
+	}
+}
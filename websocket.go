@@ -0,0 +1,563 @@
+package direwolf
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrWebSocketHandshake is returned when the server refuses the upgrade.
+	ErrWebSocketHandshake = errors.New("websocket handshake failed")
+	// ErrWebSocketProtocol is returned when the peer violates RFC 6455.
+	ErrWebSocketProtocol = errors.New("websocket protocol error")
+	// ErrWebSocketClosed is returned when writing to a closed connection.
+	ErrWebSocketClosed = errors.New("websocket closed")
+)
+
+// MessageType is the type of WebSocket message.
+type MessageType int
+
+// The message types of WebSocket, the same as the opcodes.
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// The opcodes of WebSocket frames.
+const (
+	opContinuation = 0
+	opText         = 1
+	opBinary       = 2
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+// The close codes of WebSocket, defined in RFC 6455.
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	CloseMessageTooBig    = 1009
+)
+
+// websocketGUID is used to compute Sec-WebSocket-Accept.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// CloseError is returned by ReadMessage when the peer closes the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// WebSocketOptions is the options of Session.WebSocket, pass it in the args
+// of WebSocket.
+type WebSocketOptions struct {
+	// Subprotocols is the Sec-WebSocket-Protocol to request.
+	Subprotocols []string
+
+	// ReadLimit is the max size of a message in bytes. Default is 32MB.
+	ReadLimit int64
+
+	// OnPong is called with the payload when a pong is received.
+	OnPong func(data []byte)
+
+	// CloseTimeout is the time to wait for the close frame of peer in
+	// Close. Default is 5s.
+	CloseTimeout time.Duration
+}
+
+// DefaultWebSocketOptions return a default WebSocketOptions object.
+func DefaultWebSocketOptions() *WebSocketOptions {
+	return &WebSocketOptions{
+		ReadLimit:    32 << 20,
+		CloseTimeout: 5 * time.Second,
+	}
+}
+
+// RequestOption interface method. WebSocketOptions is used by
+// Session.WebSocket, it does not change the request.
+func (options *WebSocketOptions) bindRequest(request *Request) error {
+	return nil
+}
+
+// WebSocketConn is a WebSocket connection made by Session.WebSocket.
+// ReadMessage should be called by one goroutine at a time, other methods are
+// safe for concurrent use.
+type WebSocketConn struct {
+	conn        io.ReadWriteCloser
+	reader      *bufio.Reader
+	cancel      context.CancelFunc
+	options     *WebSocketOptions
+	subprotocol string
+
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	closed        bool // the underlying connection is closed
+	closeSent     bool
+	closeErr      *CloseError // the close frame of peer
+	closeReceived chan struct{}
+	closeOnce     sync.Once
+}
+
+// WebSocket connects to the WebSocket url like "wss://example.com/ws", the
+// http and https schemes are also accepted. The upgrade request is built from
+// URL and args like Get, and sent by the Session, so the cookies, headers,
+// proxy and TLS settings of Session are used. Pass *WebSocketOptions in args
+// to request subprotocols and so on. ctx limits the handshake only, the
+// connection is not closed when ctx is done after WebSocket returns.
+func (session *Session) WebSocket(ctx context.Context, URL string, args ...RequestOption) (*WebSocketConn, error) {
+	if strings.HasPrefix(URL, "ws://") {
+		URL = "http://" + URL[len("ws://"):]
+	} else if strings.HasPrefix(URL, "wss://") {
+		URL = "https://" + URL[len("wss://"):]
+	}
+	req, err := NewRequest("GET", URL, args...)
+	if err != nil {
+		return nil, err
+	}
+	options := DefaultWebSocketOptions()
+	for _, arg := range args {
+		if o, ok := arg.(*WebSocketOptions); ok {
+			options = o
+		}
+	}
+
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	if req.Headers == nil {
+		req.Headers = http.Header{}
+	}
+	req.Headers.Set("Connection", "Upgrade")
+	req.Headers.Set("Upgrade", "websocket")
+	req.Headers.Set("Sec-WebSocket-Version", "13")
+	req.Headers.Set("Sec-WebSocket-Key", key)
+	if len(options.Subprotocols) > 0 {
+		req.Headers.Set("Sec-WebSocket-Protocol", strings.Join(options.Subprotocols, ", "))
+	}
+
+	// The connection is kept after ctx is done, it is canceled by Close.
+	// ctx cancels the connection until the handshake succeeds.
+	connCtx, connCancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, connCancel)
+	resp, cancel, err := openStream(connCtx, session, req)
+	if err != nil {
+		connCancel()
+		return nil, WrapErr(err, "websocket handshake failed")
+	}
+	closeConn := func() {
+		cancel()
+		connCancel()
+	}
+	if err := checkWebSocketHandshake(resp, key); err != nil {
+		_ = resp.Body.Close()
+		closeConn()
+		return nil, err
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		closeConn()
+		return nil, WrapErr(ErrWebSocketHandshake, "response body is not writable")
+	}
+	if !stop() { // ctx is done during the handshake
+		_ = resp.Body.Close()
+		closeConn()
+		return nil, WrapErr(ctx.Err(), "websocket handshake failed")
+	}
+	return &WebSocketConn{
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		cancel:        closeConn,
+		options:       options,
+		subprotocol:   resp.Header.Get("Sec-WebSocket-Protocol"),
+		closeReceived: make(chan struct{}),
+	}, nil
+}
+
+// checkWebSocketHandshake checks the response of upgrade request.
+func checkWebSocketHandshake(resp *http.Response, key string) error {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return WrapErrf(ErrWebSocketHandshake, "status code %d", resp.StatusCode)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return WrapErrf(ErrWebSocketHandshake, "upgrade %s", resp.Header.Get("Upgrade"))
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return WrapErr(ErrWebSocketHandshake, "invalid Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept of the key.
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Subprotocol returns the subprotocol selected by the server.
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// ReadMessage reads a text or binary message. Ping is answered and pong is
+// passed to OnPong while reading. It returns *CloseError if the peer closes
+// the connection. If ctx is done before a message is read, the connection is
+// closed and ctx.Err() is returned.
+func (c *WebSocketConn) ReadMessage(ctx context.Context) (MessageType, []byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.mu.Lock()
+	closeErr := c.closeErr
+	c.mu.Unlock()
+	if closeErr != nil {
+		return 0, nil, closeErr
+	}
+
+	stop := context.AfterFunc(ctx, c.closeConn)
+	defer stop()
+	typ, data, err := c.readMessage()
+	if err != nil && ctx.Err() != nil {
+		return 0, nil, ctx.Err()
+	}
+	return typ, data, err
+}
+
+// readMessage reads frames until a whole data message is received.
+func (c *WebSocketConn) readMessage() (MessageType, []byte, error) {
+	limit := c.options.ReadLimit
+	if limit <= 0 {
+		limit = 32 << 20
+	}
+	var typ MessageType
+	var message []byte
+	for {
+		frame, err := readFrame(c.reader, false, limit)
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+		switch frame.opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, frame.payload); err != nil && !errors.Is(err, ErrWebSocketClosed) {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			if c.options.OnPong != nil {
+				c.options.OnPong(frame.payload)
+			}
+			continue
+		case opClose:
+			return 0, nil, c.receiveClose(frame.payload)
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(WrapErr(ErrWebSocketProtocol, "expect continuation frame"))
+			}
+			typ = MessageType(frame.opcode)
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(WrapErr(ErrWebSocketProtocol, "unexpected continuation frame"))
+			}
+		}
+
+		if int64(len(message)+len(frame.payload)) > limit {
+			_ = c.sendClose(CloseMessageTooBig, "")
+			c.closeConn()
+			return 0, nil, WrapErrf(ErrWebSocketProtocol, "message exceeds read limit %d", limit)
+		}
+		message = append(message, frame.payload...)
+		if frame.fin {
+			if typ == TextMessage && !utf8.Valid(message) {
+				_ = c.sendClose(CloseInvalidPayload, "")
+				c.closeConn()
+				return 0, nil, WrapErr(ErrWebSocketProtocol, "invalid utf-8 text message")
+			}
+			return typ, message, nil
+		}
+	}
+}
+
+// fail closes the connection with protocol error if err is ErrWebSocketProtocol.
+func (c *WebSocketConn) fail(err error) error {
+	if errors.Is(err, ErrWebSocketProtocol) {
+		_ = c.sendClose(CloseProtocolError, "")
+		c.closeConn()
+	}
+	return err
+}
+
+// receiveClose replies the close frame of peer, and closes the connection.
+func (c *WebSocketConn) receiveClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) == 1 {
+		return c.fail(WrapErr(ErrWebSocketProtocol, "invalid close frame"))
+	}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+
+	// Echo the close code if the close frame has not been sent.
+	c.mu.Lock()
+	closeSent := c.closeSent
+	c.closeSent = true
+	c.closeErr = closeErr
+	c.mu.Unlock()
+	c.closeOnce.Do(func() { close(c.closeReceived) })
+	if !closeSent {
+		var echo []byte
+		if closeErr.Code != CloseNoStatusReceived {
+			echo = payload[:2]
+		}
+		_ = c.writeFrame(opClose, echo)
+	}
+	c.closeConn()
+	c.cancel()
+	return closeErr
+}
+
+// WriteMessage writes a text or binary message in a frame. If ctx is done
+// before the message is written, the connection is closed and ctx.Err() is
+// returned.
+func (c *WebSocketConn) WriteMessage(ctx context.Context, typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return WrapErrf(ErrWebSocketProtocol, "invalid message type %d", typ)
+	}
+	stop := context.AfterFunc(ctx, c.closeConn)
+	defer stop()
+	err := c.writeFrame(int(typ), data)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Ping writes a ping frame, the pong is passed to OnPong when reading.
+func (c *WebSocketConn) Ping(ctx context.Context, data []byte) error {
+	if len(data) > 125 {
+		return WrapErr(ErrWebSocketProtocol, "control frame payload too long")
+	}
+	stop := context.AfterFunc(ctx, c.closeConn)
+	defer stop()
+	err := c.writeFrame(opPing, data)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Close sends a close frame with code and reason, waits for the close frame
+// of peer until CloseTimeout, then closes the connection. It returns nil if
+// the connection has been closed.
+func (c *WebSocketConn) Close(code int, reason string) error {
+	defer c.cancel()
+	defer c.closeConn()
+	if err := c.sendClose(code, reason); err != nil {
+		if errors.Is(err, ErrWebSocketClosed) {
+			return nil
+		}
+		return err
+	}
+
+	timeout := c.options.CloseTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if !c.readMu.TryLock() { // the close frame is received by ReadMessage
+		select {
+		case <-c.closeReceived:
+		case <-time.After(timeout):
+		}
+		return nil
+	}
+	defer c.readMu.Unlock()
+	timer := time.AfterFunc(timeout, c.closeConn)
+	defer timer.Stop()
+	for { // discard messages until the close frame
+		frame, err := readFrame(c.reader, false, 1<<20)
+		if err != nil {
+			return nil
+		}
+		if frame.opcode == opClose {
+			_ = c.receiveClose(frame.payload)
+			return nil
+		}
+	}
+}
+
+// sendClose writes a close frame once, it returns ErrWebSocketClosed if the
+// close frame has been sent.
+func (c *WebSocketConn) sendClose(code int, reason string) error {
+	c.mu.Lock()
+	if c.closeSent {
+		c.mu.Unlock()
+		return ErrWebSocketClosed
+	}
+	c.closeSent = true
+	c.mu.Unlock()
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return c.writeFrame(opClose, payload)
+}
+
+// writeFrame writes a masked frame, it returns ErrWebSocketClosed if a data
+// frame is written after the close frame.
+func (c *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.mu.Lock()
+	closed := c.closed || (c.closeSent && opcode != opClose)
+	c.mu.Unlock()
+	if closed {
+		return ErrWebSocketClosed
+	}
+	return writeFrame(c.conn, true, opcode, true, payload)
+}
+
+// closeConn closes the underlying connection.
+func (c *WebSocketConn) closeConn() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	_ = c.conn.Close()
+}
+
+// wsFrame is a frame of WebSocket.
+type wsFrame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+// readFrame reads a frame, masked is whether the frame should be masked,
+// that is, the frame is sent by client. The payload is limited by limit.
+func readFrame(r *bufio.Reader, masked bool, limit int64) (*wsFrame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	frame := &wsFrame{fin: head[0]&0x80 != 0, opcode: int(head[0] & 0x0f)}
+	if head[0]&0x70 != 0 {
+		return nil, WrapErr(ErrWebSocketProtocol, "reserved bits are set")
+	}
+	switch frame.opcode {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		if !frame.fin || head[1]&0x7f > 125 {
+			return nil, WrapErr(ErrWebSocketProtocol, "invalid control frame")
+		}
+	default:
+		return nil, WrapErrf(ErrWebSocketProtocol, "unknown opcode %d", frame.opcode)
+	}
+	if (head[1]&0x80 != 0) != masked {
+		return nil, WrapErr(ErrWebSocketProtocol, "invalid mask bit")
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > uint64(limit) {
+		return nil, WrapErrf(ErrWebSocketProtocol, "frame exceeds read limit %d", limit)
+	}
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, maskKey[:]); err != nil {
+			return nil, err
+		}
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return nil, err
+	}
+	if masked {
+		maskBytes(maskKey, frame.payload)
+	}
+	return frame, nil
+}
+
+// writeFrame writes a frame, the payload is masked by a random key if masked.
+func writeFrame(w io.Writer, fin bool, opcode int, masked bool, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		buf = append(buf, maskBit|byte(length))
+	case length <= 0xffff:
+		buf = append(buf, maskBit|126, byte(length>>8), byte(length))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(length))
+	}
+
+	if !masked {
+		buf = append(buf, payload...)
+	} else {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return err
+		}
+		buf = append(buf, maskKey[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(maskKey, buf[start:])
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// maskBytes masks or unmasks the payload by key in place.
+func maskBytes(key [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= key[i%4]
+	}
+}
@@ -0,0 +1,195 @@
+package direwolf
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWebSocketHandler returns a WebSocket echo server. It sends a ping and a
+// fragmented message first, then echoes the messages until closed.
+func newWebSocketHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "logged-in"})
+			return
+		}
+		if cookie, err := r.Cookie("sid"); err != nil || cookie.Value != "logged-in" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Connection", "Upgrade")
+		w.Header().Set("Sec-WebSocket-Accept", websocketAccept(r.Header.Get("Sec-WebSocket-Key")))
+		if strings.Contains(r.Header.Get("Sec-WebSocket-Protocol"), "chat") {
+			w.Header().Set("Sec-WebSocket-Protocol", "chat")
+		}
+		w.WriteHeader(http.StatusSwitchingProtocols)
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_ = rw.Flush()
+		reader := bufio.NewReader(rw)
+
+		_ = writeFrame(conn, true, opPing, false, []byte("are you there"))
+		_ = writeFrame(conn, false, opText, false, []byte("hello "))
+		_ = writeFrame(conn, true, opContinuation, false, []byte("world"))
+		for {
+			frame, err := readFrame(reader, true, 1<<20)
+			if err != nil {
+				return
+			}
+			switch frame.opcode {
+			case opPong:
+				_ = writeFrame(conn, true, opText, false, append([]byte("pong: "), frame.payload...))
+			case opClose:
+				_ = writeFrame(conn, true, opClose, false, frame.payload)
+				return
+			default:
+				_ = writeFrame(conn, true, frame.opcode, false, frame.payload)
+			}
+		}
+	})
+}
+
+func TestSessionWebSocket(t *testing.T) {
+	ts := httptest.NewServer(newWebSocketHandler(t))
+	defer ts.Close()
+
+	session := NewSession()
+	if _, err := session.Get(ts.URL + "/login"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	conn, err := session.WebSocket(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/ws",
+		&WebSocketOptions{Subprotocols: []string{"chat", "v2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Subprotocol() != "chat" {
+		t.Fatal("subprotocol failed: ", conn.Subprotocol())
+	}
+
+	typ, data, err := conn.ReadMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != TextMessage || string(data) != "hello world" {
+		t.Fatal("fragmented message failed: ", string(data))
+	}
+	// the ping is answered while reading.
+	if _, data, err = conn.ReadMessage(ctx); err != nil || string(data) != "pong: are you there" {
+		t.Fatal("ping should be answered: ", string(data), err)
+	}
+
+	if err := conn.WriteMessage(ctx, BinaryMessage, []byte{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if typ, data, err = conn.ReadMessage(ctx); err != nil || typ != BinaryMessage || len(data) != 3 {
+		t.Fatal("binary message failed: ", data, err)
+	}
+	long := strings.Repeat("x", 70000)
+	if err := conn.WriteMessage(ctx, TextMessage, []byte(long)); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err = conn.ReadMessage(ctx); err != nil || string(data) != long {
+		t.Fatal("long message failed: ", len(data), err)
+	}
+
+	if err := conn.Close(CloseNormalClosure, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(ctx, TextMessage, []byte("after close")); !errors.Is(err, ErrWebSocketClosed) {
+		t.Fatal("write after close should fail: ", err)
+	}
+	var closeErr *CloseError
+	if _, _, err := conn.ReadMessage(ctx); !errors.As(err, &closeErr) || closeErr.Code != CloseNormalClosure {
+		t.Fatal("read after close should return the close frame of peer: ", err)
+	}
+
+	// The connection is closed if ctx is done when reading.
+	conn, err = session.WebSocket(ctx, ts.URL+"/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := conn.ReadMessage(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := conn.ReadMessage(readCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("ReadMessage should return when ctx is done: ", err)
+	}
+	if err := conn.WriteMessage(ctx, TextMessage, []byte("x")); !errors.Is(err, ErrWebSocketClosed) {
+		t.Fatal("connection should be closed: ", err)
+	}
+	if err := conn.Close(CloseNormalClosure, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionWebSocketClose(t *testing.T) {
+	ts := httptest.NewUnstartedServer(newWebSocketHandler(t))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	session := NewSession()
+	session.SetCookies(ts.URL, Cookies{{Name: "sid", Value: "logged-in"}})
+	ctx := context.Background()
+	conn, err := session.WebSocket(ctx, "wss"+strings.TrimPrefix(ts.URL, "https"), InsecureSkipVerify(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(ctx); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(ctx); err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	if err := conn.Close(CloseGoingAway, ""); err != nil {
+		t.Fatal(err)
+	}
+	var closeErr *CloseError
+	if err := <-done; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway {
+		t.Fatal("ReadMessage should return the close frame of peer: ", err)
+	}
+
+	_, err = NewSession().WebSocket(ctx, "wss"+strings.TrimPrefix(ts.URL, "https"), InsecureSkipVerify(true))
+	if !errors.Is(err, ErrWebSocketHandshake) {
+		t.Fatal("handshake without cookie should fail: ", err)
+	}
+}
+
+func TestSessionWebSocketHandshakeCancel(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // the handshake stalls
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := NewSession().WebSocket(ctx, "ws"+strings.TrimPrefix(ts.URL, "http"), Timeout(10))
+	if !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Fatal("canceling ctx should stop the handshake: ", err, time.Since(start))
+	}
+}